@@ -0,0 +1,140 @@
+// Package errcheck checks Go packages for unchecked errors. It is the library
+// used to implement the errcheck command-line tool, and lets other tools run
+// the same checks, add their own to Checker.Checks and exclude calls with
+// Checker.AddExcludeFunc.
+//
+// Note: The API of this package has not been finalized and may change at any point.
+package errcheck
+
+import (
+	"io"
+
+	impl "github.com/kisielk/errcheck/internal/errcheck"
+)
+
+// Checker checks Go packages for unchecked errors.
+type Checker = impl.Checker
+
+// NewChecker returns a Checker with the default exclude profile and iterator types.
+func NewChecker() *Checker {
+	return impl.NewChecker()
+}
+
+// Check is a rule run over the syntax of the checked files, added to
+// Checker.Checks.
+type Check = impl.Check
+
+// Pass is the interface between a Check and the package being checked.
+type Pass = impl.Pass
+
+// Result is the outcome of checking packages with Checker.Run.
+type Result = impl.Result
+
+// Stats are statistics about a run of the Checker.
+type Stats = impl.Stats
+
+// PackageError reports the errors encountered while loading a package.
+type PackageError = impl.PackageError
+
+// UncheckedError indicates the position of an unchecked error return.
+type UncheckedError = impl.UncheckedError
+
+// UncheckedErrors is returned by Checker.CheckPackages when there are
+// unchecked errors.
+type UncheckedErrors = impl.UncheckedErrors
+
+// DroppedResult is a result of a call or type assertion whose error is left unchecked.
+type DroppedResult = impl.DroppedResult
+
+// ErrorKind is the kind of an unchecked error.
+type ErrorKind = impl.ErrorKind
+
+// The kinds of unchecked errors.
+const (
+	UncheckedCall      = impl.UncheckedCall
+	BlankAssignment    = impl.BlankAssignment
+	UncheckedAssertion = impl.UncheckedAssertion
+	UncheckedIterator  = impl.UncheckedIterator
+)
+
+// ErrNoGoFiles is returned when CheckPackages is run on a package with no
+// Go source files.
+var ErrNoGoFiles = impl.ErrNoGoFiles
+
+// ExcludeFunc is a predicate excluding calls from checking; see
+// Checker.AddExcludeFunc.
+type ExcludeFunc = impl.ExcludeFunc
+
+// ExcludeEntry is an entry of the effective exclude list.
+type ExcludeEntry = impl.ExcludeEntry
+
+// DefaultExcludeProfile is the exclude profile of a new Checker.
+const DefaultExcludeProfile = impl.DefaultExcludeProfile
+
+// ExcludeProfiles lists the names of the built-in exclude profiles.
+var ExcludeProfiles = impl.ExcludeProfiles
+
+// IteratorType describes a type whose iteration method reports failure only
+// by stopping, like bufio.Scanner's Scan and Err methods.
+type IteratorType = impl.IteratorType
+
+// DefaultIteratorTypes are the standard library iterator types checked by
+// a new Checker.
+var DefaultIteratorTypes = impl.DefaultIteratorTypes
+
+// ParseIteratorType parses an iterator type of the form (TYPE).ADVANCE:ERR.
+func ParseIteratorType(s string) (IteratorType, error) {
+	return impl.ParseIteratorType(s)
+}
+
+// BuildConfig is a build configuration packages are checked in.
+type BuildConfig = impl.BuildConfig
+
+// FindModules returns the absolute directories of the modules to check
+// beneath root, for Checker.RunModules.
+func FindModules(root string) ([]string, error) {
+	return impl.FindModules(root)
+}
+
+// CallExplanation describes how a call is checked; see Checker.Explain.
+type CallExplanation = impl.CallExplanation
+
+// Changes records the lines added or modified by a diff.
+type Changes = impl.Changes
+
+// ParseDiff reads the lines added or modified by a unified diff, resolving
+// file names relative to dir.
+func ParseDiff(r io.Reader, dir string) (Changes, error) {
+	return impl.ParseDiff(r, dir)
+}
+
+// GitChanges returns the lines added or modified since the git revision rev.
+func GitChanges(rev string) (Changes, error) {
+	return impl.GitChanges(rev)
+}
+
+// Staged describes the Go files staged in the git index of the current repository.
+type Staged = impl.Staged
+
+// GitStaged reads the staged Go files and hunks from the git index.
+func GitStaged() (*Staged, error) {
+	return impl.GitStaged()
+}
+
+// LogLevel is the verbosity of a Logger.
+type LogLevel = impl.LogLevel
+
+// The log levels, from the least to the most verbose.
+const (
+	LogInfo  = impl.LogInfo
+	LogDebug = impl.LogDebug
+	LogTrace = impl.LogTrace
+)
+
+// Logger receives the log messages of a Checker.
+type Logger = impl.Logger
+
+// NewLogger returns a Logger writing the messages up to level to w.
+func NewLogger(w io.Writer, level LogLevel) Logger {
+	return impl.NewLogger(w, level)
+}
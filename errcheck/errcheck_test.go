@@ -0,0 +1,79 @@
+package errcheck_test
+
+import (
+	"go/ast"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/tools/go/packages"
+
+	"github.com/kisielk/errcheck/errcheck"
+)
+
+const testModuleMain = `package main
+
+import (
+	"errors"
+	"os"
+)
+
+func mayFail() error { return errors.New("failed") }
+
+func main() {
+	mayFail()
+	os.Remove("file")
+	os.Exit(1)
+}
+`
+
+// exitCheck reports calls to os.Exit, which skip deferred calls.
+type exitCheck struct{}
+
+func (exitCheck) Check(pass *errcheck.Pass, node ast.Node) {
+	call, ok := node.(*ast.CallExpr)
+	if ok && pass.FuncName(call) == "os.Exit" {
+		pass.Report(call.Lparen, call, errcheck.UncheckedCall, "os.Exit skips deferred calls")
+	}
+}
+
+// TestChecker ensures that checks and exclude funcs can be added from outside
+// the module.
+func TestChecker(t *testing.T) {
+	dir, err := ioutil.TempDir("", "testchecker")
+	if err != nil {
+		t.Fatalf("unable to create testchecker directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, src := range map[string]string{
+		"go.mod":  "module example.com/checker\n",
+		"main.go": testModuleMain,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	checker := errcheck.NewChecker()
+	checker.Checks = []errcheck.Check{exitCheck{}}
+	checker.AddExcludeFunc("may-fail", func(fn *types.Func, call *ast.CallExpr, names []string, pkg *packages.Package) bool {
+		return fn.Name() == "mayFail"
+	})
+	r, err := checker.RunModules([]string{dir}, ".")
+	if err != nil {
+		t.Fatalf("RunModules failed: %v", err)
+	}
+
+	var got []string
+	for _, e := range r.Errors {
+		got = append(got, e.FuncName+" "+e.Message)
+	}
+	want := []string{"os.Remove ", "os.Exit os.Exit skips deferred calls"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got errors %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/kisielk/errcheck/internal/errcheck"
+)
+
+// findingMessage describes an unchecked error for reports that do not
+// include the source line.
+func findingMessage(e errcheck.UncheckedError) string {
+	msg := "unchecked error: " + e.Line
+	if e.ExprLine != "" {
+		msg = "unchecked error: " + e.ExprLine
+	}
+	if e.FuncName != "" {
+		msg = "error return value of " + e.FuncName + " is not checked"
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if len(e.Configs) > 0 {
+		msg += " (in " + strings.Join(e.Configs, ", ") + ")"
+	}
+	return msg
+}
+
+// findingSource returns the source line of an unchecked error, or the whole
+// of the offending expression, printed on one line, if it spans several.
+func findingSource(e errcheck.UncheckedError) string {
+	if !strings.Contains(e.Expr, "\n") {
+		return e.Line
+	}
+	return e.ExprLine
+}
+
+type checkstyleReport struct {
+	XMLName xml.Name         `xml:"checkstyle"`
+	Version string           `xml:"version,attr"`
+	Files   []checkstyleFile `xml:"file"`
+}
+
+type checkstyleFile struct {
+	Name   string            `xml:"name,attr"`
+	Errors []checkstyleError `xml:"error"`
+}
+
+type checkstyleError struct {
+	Line     int    `xml:"line,attr"`
+	Column   int    `xml:"column,attr"`
+	Severity string `xml:"severity,attr"`
+	Message  string `xml:"message,attr"`
+	Source   string `xml:"source,attr"`
+}
+
+// writeCheckstyle writes the errors as a Checkstyle XML report, with the
+// errors grouped by file.
+func writeCheckstyle(w io.Writer, errors []errcheck.UncheckedError) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		wd = ""
+	}
+
+	report := checkstyleReport{Version: "5.0"}
+	files := make(map[string]int) // file name -> index in report.Files
+	for _, e := range errors {
+		name := relativePath(wd, e.Pos.Filename)
+		i, ok := files[name]
+		if !ok {
+			i = len(report.Files)
+			files[name] = i
+			report.Files = append(report.Files, checkstyleFile{Name: name})
+		}
+		report.Files[i].Errors = append(report.Files[i].Errors, checkstyleError{
+			Line:     e.Pos.Line,
+			Column:   e.Pos.Column,
+			Severity: "error",
+			Message:  findingMessage(e),
+			Source:   "errcheck",
+		})
+	}
+	return writeXML(w, report)
+}
+
+type junitReport struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnit writes the errors as a JUnit XML report, with a failing test
+// case for each error, named after its position and classed by its package,
+// and a passing one for each package checked without errors.
+func writeJUnit(w io.Writer, packages []string, errors []errcheck.UncheckedError) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		wd = ""
+	}
+
+	found := make(map[string][]errcheck.UncheckedError)
+	for _, e := range errors {
+		found[e.Package] = append(found[e.Package], e)
+	}
+	pkgs := append([]string{}, packages...)
+	for pkg := range found {
+		if i := sort.SearchStrings(packages, pkg); i == len(packages) || packages[i] != pkg {
+			pkgs = append(pkgs, pkg)
+		}
+	}
+	sort.Strings(pkgs)
+
+	suite := junitSuite{Name: "errcheck"}
+	for _, pkg := range pkgs {
+		errs := found[pkg]
+		if len(errs) == 0 {
+			suite.Cases = append(suite.Cases, junitCase{Name: pkg, ClassName: pkg})
+			continue
+		}
+		for _, e := range errs {
+			pos := relativePos(wd, e.Pos)
+			suite.Cases = append(suite.Cases, junitCase{
+				Name:      pos,
+				ClassName: pkg,
+				Failure: &junitFailure{
+					Type:    "errcheck",
+					Message: findingMessage(e),
+					Text:    pos + ": " + findingSource(e) + "\n",
+				},
+			})
+			suite.Failures++
+		}
+	}
+	suite.Tests = len(suite.Cases)
+	return writeXML(w, junitReport{Suites: []junitSuite{suite}})
+}
+
+func writeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// templatePresets are the named templates accepted by -format-template.
+var templatePresets = map[string]string{
+	// vet formats errors like go vet.
+	"vet": "{{.Path}}:{{.Pos.Line}}:{{.Pos.Column}}: {{.Summary}}",
+	// quickfix matches the default errorformat of vim's quickfix list.
+	"quickfix": "{{.Path}}:{{.Pos.Line}}:{{.Pos.Column}}: {{.Kind}}: {{.Source}}",
+	// github formats errors as GitHub Actions workflow commands, which
+	// annotate the lines in pull requests.
+	"github": "::error file={{githubProperty .Path}},line={{.Pos.Line}},endLine={{.End.Line}},col={{.Pos.Column}},title=errcheck::{{github .Summary}}",
+}
+
+// templateFinding is the data an unchecked error is rendered with by -format-template.
+type templateFinding struct {
+	errcheck.UncheckedError
+
+	// Path is the name of the file, relative to the current directory unless
+	// -abspath is set.
+	Path string
+
+	// Summary describes the error without the source line.
+	Summary string
+
+	// Source is the source line, or the whole of the offending call or type
+	// assertion joined into one line if it spans several.
+	Source string
+}
+
+var templateFuncs = template.FuncMap{
+	"github":         escapeGitHub,
+	"githubProperty": escapeGitHubProperty,
+}
+
+// escapeGitHub escapes s for use as the message of a GitHub Actions workflow command.
+func escapeGitHub(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// escapeGitHubProperty escapes s for use as a property value of a GitHub
+// Actions workflow command, such as its file name.
+func escapeGitHubProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
+
+// parseFormatTemplate parses a -format-template value, which is either the
+// name of a preset or a text/template rendering a templateFinding.
+func parseFormatTemplate(text string) (*template.Template, error) {
+	if preset, ok := templatePresets[text]; ok {
+		text = preset
+	}
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	return template.New("format").Funcs(templateFuncs).Parse(text)
+}
+
+// writeTemplate writes each error rendered by tmpl.
+func writeTemplate(w io.Writer, tmpl *template.Template, errors []errcheck.UncheckedError) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		wd = ""
+	}
+	for _, e := range errors {
+		f := templateFinding{
+			UncheckedError: e,
+			Path:           relativePath(wd, e.Pos.Filename),
+			Summary:        findingMessage(e),
+			Source:         findingSource(e),
+		}
+		if err := tmpl.Execute(w, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
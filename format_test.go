@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kisielk/errcheck/internal/errcheck"
+)
+
+func testFindings(t *testing.T) []errcheck.UncheckedError {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Cannot receive current directory: %v", err)
+	}
+	pos := func(file string, line, col int) token.Position {
+		return token.Position{Filename: filepath.Join(wd, file), Line: line, Column: col}
+	}
+	return []errcheck.UncheckedError{
+		{
+			Pos:      pos("a.go", 3, 7),
+			Start:    pos("a.go", 3, 1),
+			End:      pos("a.go", 3, 10),
+			Line:     "f.Close()",
+			Expr:     "f.Close()",
+			ExprLine: "f.Close()",
+			FuncName: "(*os.File).Close",
+			Package:  "example.com/a",
+		},
+		{
+			Pos:      pos("a.go", 5, 2),
+			Start:    pos("a.go", 5, 5),
+			End:      pos("a.go", 5, 12),
+			Line:     "_ = x.(int)",
+			Expr:     "x.(int)",
+			ExprLine: "x.(int)",
+			Package:  "example.com/a",
+			Kind:     errcheck.UncheckedAssertion,
+		},
+		{
+			Pos:      pos(filepath.Join("b", "b.go"), 9, 8),
+			Start:    pos(filepath.Join("b", "b.go"), 9, 7),
+			End:      pos(filepath.Join("b", "b.go"), 9, 16),
+			Line:     "defer f.Close()",
+			Expr:     "f.Close()",
+			ExprLine: "f.Close()",
+			FuncName: "(*os.File).Close",
+			Package:  "example.com/a/b",
+			Message:  "deferred Close of a writable file may lose data",
+		},
+		{
+			Pos:      pos(filepath.Join("b", "b.go"), 12, 9),
+			Start:    pos(filepath.Join("b", "b.go"), 12, 2),
+			End:      pos(filepath.Join("b", "b.go"), 15, 3),
+			Line:     "f.Write( // data",
+			Expr:     "f.Write( // data\n\t\t[]byte{\n\t\t\t1, 2,\n\t\t},\n\t)",
+			ExprLine: "f.Write([]byte{1, 2})",
+			FuncName: "(*os.File).Write",
+			Package:  "example.com/a/b",
+		},
+	}
+}
+
+func TestFindingSource(t *testing.T) {
+	findings := testFindings(t)
+	want := []string{"f.Close()", "_ = x.(int)", "defer f.Close()", "f.Write([]byte{1, 2})"}
+	for i, e := range findings {
+		if got := findingSource(e); got != want[i] {
+			t.Errorf("%d: findingSource got %q want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestWriteCheckstyle(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeCheckstyle(&buf, testFindings(t)); err != nil {
+		t.Fatal(err)
+	}
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<checkstyle version="5.0">
+  <file name="a.go">
+    <error line="3" column="7" severity="error" message="error return value of (*os.File).Close is not checked" source="errcheck"></error>
+    <error line="5" column="2" severity="error" message="unchecked error: x.(int)" source="errcheck"></error>
+  </file>
+  <file name="b/b.go">
+    <error line="9" column="8" severity="error" message="error return value of (*os.File).Close is not checked: deferred Close of a writable file may lose data" source="errcheck"></error>
+    <error line="12" column="9" severity="error" message="error return value of (*os.File).Write is not checked" source="errcheck"></error>
+  </file>
+</checkstyle>
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	var buf bytes.Buffer
+	packages := []string{"example.com/a", "example.com/a/b", "example.com/c"}
+	if err := writeJUnit(&buf, packages, testFindings(t)); err != nil {
+		t.Fatal(err)
+	}
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+  <testsuite name="errcheck" tests="5" failures="4">
+    <testcase name="a.go:3:7" classname="example.com/a">
+      <failure message="error return value of (*os.File).Close is not checked" type="errcheck">a.go:3:7: f.Close()&#xA;</failure>
+    </testcase>
+    <testcase name="a.go:5:2" classname="example.com/a">
+      <failure message="unchecked error: x.(int)" type="errcheck">a.go:5:2: _ = x.(int)&#xA;</failure>
+    </testcase>
+    <testcase name="b/b.go:9:8" classname="example.com/a/b">
+      <failure message="error return value of (*os.File).Close is not checked: deferred Close of a writable file may lose data" type="errcheck">b/b.go:9:8: defer f.Close()&#xA;</failure>
+    </testcase>
+    <testcase name="b/b.go:12:9" classname="example.com/a/b">
+      <failure message="error return value of (*os.File).Write is not checked" type="errcheck">b/b.go:12:9: f.Write([]byte{1, 2})&#xA;</failure>
+    </testcase>
+    <testcase name="example.com/c" classname="example.com/c"></testcase>
+  </testsuite>
+</testsuites>
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	buf.Reset()
+	if err := writeJUnit(&buf, packages, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); !strings.Contains(got, `<testsuite name="errcheck" tests="3" failures="0">`) {
+		t.Errorf("clean run got:\n%s", got)
+	}
+}
+
+func TestWriteTemplate(t *testing.T) {
+	cases := []struct {
+		template string
+		want     string
+	}{
+		{"vet", `a.go:3:7: error return value of (*os.File).Close is not checked
+a.go:5:2: unchecked error: x.(int)
+b/b.go:9:8: error return value of (*os.File).Close is not checked: deferred Close of a writable file may lose data
+b/b.go:12:9: error return value of (*os.File).Write is not checked
+`},
+		{"quickfix", `a.go:3:7: call: f.Close()
+a.go:5:2: assert: _ = x.(int)
+b/b.go:9:8: call: defer f.Close()
+b/b.go:12:9: call: f.Write([]byte{1, 2})
+`},
+		{"github", `::error file=a.go,line=3,endLine=3,col=7,title=errcheck::error return value of (*os.File).Close is not checked
+::error file=a.go,line=5,endLine=5,col=2,title=errcheck::unchecked error: x.(int)
+::error file=b/b.go,line=9,endLine=9,col=8,title=errcheck::error return value of (*os.File).Close is not checked: deferred Close of a writable file may lose data
+::error file=b/b.go,line=12,endLine=15,col=9,title=errcheck::error return value of (*os.File).Write is not checked
+`},
+		{"{{.Package}} {{.FuncName}}\n", `example.com/a (*os.File).Close
+example.com/a 
+example.com/a/b (*os.File).Close
+example.com/a/b (*os.File).Write
+`},
+	}
+	for _, c := range cases {
+		tmpl, err := parseFormatTemplate(c.template)
+		if err != nil {
+			t.Fatalf("parseFormatTemplate(%q): %v", c.template, err)
+		}
+		var buf bytes.Buffer
+		if err := writeTemplate(&buf, tmpl, testFindings(t)); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != c.want {
+			t.Errorf("%s: got:\n%s\nwant:\n%s", c.template, got, c.want)
+		}
+	}
+
+	if _, err := parseFormatTemplate("{{.Path"); err == nil {
+		t.Error("expected an error for an invalid template")
+	}
+}
+
+func TestEscapeGitHub(t *testing.T) {
+	if got, want := escapeGitHub("50%: a,\nb"), "50%25: a,%0Ab"; got != want {
+		t.Errorf("escapeGitHub got %q want %q", got, want)
+	}
+	if got, want := escapeGitHubProperty("c:/a,b.go"), "c%3A/a%2Cb.go"; got != want {
+		t.Errorf("escapeGitHubProperty got %q want %q", got, want)
+	}
+}
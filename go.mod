@@ -1,3 +1,10 @@
 module github.com/kisielk/errcheck
 
-require golang.org/x/tools v0.0.0-20181030221726-6c7e314b6563
+go 1.25.0
+
+require (
+	golang.org/x/mod v0.37.0
+	golang.org/x/tools v0.47.0
+)
+
+require golang.org/x/sync v0.21.0 // indirect
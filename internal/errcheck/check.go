@@ -0,0 +1,204 @@
+package errcheck
+
+import (
+	"go/ast"
+	"go/token"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// Check is a rule run over the syntax of the checked files. Checks report
+// unchecked errors through a Pass, which also gives them access to the
+// exclude and ignore rules of the Checker.
+//
+// The Checker runs the built-in checks for unchecked calls and, if enabled,
+// blank assignments and type assertions, followed by those in Checker.Checks.
+type Check interface {
+	// Check is called for every node of every checked file, in the order of
+	// ast.Walk. Calls for the files of a package are never concurrent, but
+	// those for different packages may be.
+	Check(pass *Pass, node ast.Node)
+}
+
+// Pass is the interface between a Check and the package being checked.
+type Pass struct {
+	Pkg  *packages.Package
+	File *ast.File
+
+	v *visitor
+}
+
+// FuncName returns the full name of the function called, such as
+// "(*os.File).Close", or the empty string if it cannot be resolved.
+func (p *Pass) FuncName(call *ast.CallExpr) string {
+	return p.v.fullName(call)
+}
+
+// ReturnsError reports whether call returns an error, or is a call to recover.
+func (p *Pass) ReturnsError(call *ast.CallExpr) bool {
+	return p.v.callReturnsError(call)
+}
+
+// ErrorsByArg reports, for each result of call, whether it is an error.
+func (p *Pass) ErrorsByArg(call *ast.CallExpr) []bool {
+	return p.v.errorsByArg(call)
+}
+
+// SuppressedBy describes the exclude or ignore rule matching call, such as
+// "exclude: (*os.File).Close", or returns the empty string if none does.
+func (p *Pass) SuppressedBy(call *ast.CallExpr) string {
+	return p.v.suppressedBy(call)
+}
+
+// Report records an unchecked error at pos, regardless of the exclude and
+// ignore rules. Expr is the call or type assertion leaving the error
+// unchecked, and may be nil. The message, if not empty, explains why the
+// error is reported.
+func (p *Pass) Report(pos token.Pos, expr ast.Expr, kind ErrorKind, message string) {
+	p.v.addErrorWithMessage(pos, expr, kind, message)
+}
+
+// ReportCall records an unchecked error at pos in call, unless call is
+// excluded or ignored.
+func (p *Pass) ReportCall(pos token.Pos, call *ast.CallExpr, kind ErrorKind) {
+	p.v.addCallError(pos, call, kind, p.v.suppressedBy(call))
+}
+
+// checks returns the checks to run: the enabled built-in checks followed by c.Checks.
+func (c *Checker) checks() []Check {
+	checks := []Check{callCheck{}}
+	if c.Blank {
+		checks = append(checks, blankCheck{})
+	}
+	if c.Asserts {
+		checks = append(checks, assertCheck{})
+	}
+	return append(checks, c.Checks...)
+}
+
+// callCheck reports calls whose error result is discarded by an expression,
+// go or defer statement.
+type callCheck struct{}
+
+func (callCheck) Check(pass *Pass, node ast.Node) {
+	v := pass.v
+	switch stmt := node.(type) {
+	case *ast.ExprStmt:
+		if call, ok := stmt.X.(*ast.CallExpr); ok {
+			if v.callReturnsError(call) {
+				v.addCallError(call.Lparen, call, UncheckedCall, v.suppressedBy(call))
+			}
+		}
+	case *ast.GoStmt:
+		if v.callReturnsError(stmt.Call) {
+			e := v.newError(stmt.Call.Lparen, stmt.Call, UncheckedCall)
+			e.Go = true
+			v.report(e, v.suppressedBy(stmt.Call))
+		}
+	case *ast.DeferStmt:
+		if v.callReturnsError(stmt.Call) {
+			e := v.newError(stmt.Call.Lparen, stmt.Call, UncheckedCall)
+			e.Defer = true
+			rule, message := v.deferredCallRule(stmt.Call)
+			e.Message = message
+			v.report(e, rule)
+		}
+	}
+}
+
+// blankCheck reports error results of calls assigned to the blank identifier.
+type blankCheck struct{}
+
+func (blankCheck) Check(pass *Pass, node ast.Node) {
+	v := pass.v
+	stmt, ok := node.(*ast.AssignStmt)
+	if !ok {
+		return
+	}
+	if len(stmt.Rhs) == 1 {
+		// single value on rhs; check against lhs identifiers
+		call, ok := stmt.Rhs[0].(*ast.CallExpr)
+		if !ok {
+			return
+		}
+		rule := v.suppressedBy(call)
+		isError := v.errorsByArg(call)
+		for i := 0; i < len(stmt.Lhs); i++ {
+			if id, ok := stmt.Lhs[i].(*ast.Ident); ok {
+				// We shortcut calls to recover() because errorsByArg can't
+				// check its return types for errors since it returns interface{}.
+				if id.Name == "_" && (v.isRecover(call) || isError[i]) {
+					e := v.newError(id.NamePos, call, BlankAssignment)
+					e.Dropped = droppedAt(e.Dropped, i)
+					v.report(e, rule)
+				}
+			}
+		}
+		return
+	}
+	// multiple value on rhs; in this case a call can't return
+	// multiple values. Assume len(stmt.Lhs) == len(stmt.Rhs)
+	for i := 0; i < len(stmt.Lhs); i++ {
+		if id, ok := stmt.Lhs[i].(*ast.Ident); ok {
+			if call, ok := stmt.Rhs[i].(*ast.CallExpr); ok {
+				if id.Name == "_" && v.callReturnsError(call) {
+					e := v.newError(id.NamePos, call, BlankAssignment)
+					e.Dropped = droppedAt(e.Dropped, 0)
+					v.report(e, v.suppressedBy(call))
+				}
+			}
+		}
+	}
+}
+
+// assertCheck reports type assertions whose ok result is discarded, or
+// assigned to the blank identifier if blank assignments are checked.
+type assertCheck struct{}
+
+func (assertCheck) Check(pass *Pass, node ast.Node) {
+	v := pass.v
+	stmt, ok := node.(*ast.AssignStmt)
+	if !ok {
+		return
+	}
+	if len(stmt.Rhs) == 1 {
+		assert, ok := stmt.Rhs[0].(*ast.TypeAssertExpr)
+		if !ok || assert.Type == nil {
+			// not an assertion, or a type switch
+			return
+		}
+		if len(stmt.Lhs) < 2 {
+			// assertion result not read
+			v.addErrorAtPosition(stmt.Rhs[0].Pos(), assert, UncheckedAssertion)
+		} else if id, ok := stmt.Lhs[1].(*ast.Ident); ok && v.blank && id.Name == "_" {
+			// assertion result ignored
+			v.addErrorAtPosition(id.NamePos, assert, UncheckedAssertion)
+		}
+		return
+	}
+	// multiple value on rhs; in this case an assertion can't return
+	// multiple values. Assume len(stmt.Lhs) == len(stmt.Rhs)
+	for i := 0; i < len(stmt.Lhs); i++ {
+		if _, ok := stmt.Lhs[i].(*ast.Ident); !ok {
+			continue
+		}
+		if assert, ok := stmt.Rhs[i].(*ast.TypeAssertExpr); ok {
+			if assert.Type == nil {
+				// Shouldn't happen anyway, no multi assignment in type switches
+				continue
+			}
+			v.addErrorAtPosition(stmt.Lhs[i].Pos(), assert, UncheckedAssertion)
+		}
+	}
+}
+
+// droppedAt returns the result at index among dropped, which is only the
+// result assigned to the blank identifier for a blank assignment.
+func droppedAt(dropped []DroppedResult, index int) []DroppedResult {
+	for _, r := range dropped {
+		if r.Index == index {
+			return []DroppedResult{r}
+		}
+	}
+	return dropped
+}
@@ -0,0 +1,146 @@
+package errcheck
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/types"
+)
+
+// fileMode is how a file handle was opened, as far as can be told from its constructor.
+type fileMode int
+
+const (
+	fileUnknown fileMode = iota
+	fileReadOnly
+	fileWritable
+)
+
+// writableCloseMessage is attached to deferred Close calls on writable files.
+const writableCloseMessage = "deferred Close of a writable file may lose data; merge its error into a named return value"
+
+// fileConstructors maps the functions returning an *os.File to the mode of
+// the handle they return. os.OpenFile is handled separately as its mode
+// depends on its flag argument.
+var fileConstructors = map[string]fileMode{
+	"os.Open":            fileReadOnly,
+	"os.Create":          fileWritable,
+	"os.CreateTemp":      fileWritable,
+	"io/ioutil.TempFile": fileWritable,
+}
+
+// findFileModes records in v.fileModes the mode of every variable in file
+// that is assigned the result of a known *os.File constructor. A variable
+// assigned from several constructors is writable if any of them is.
+func (v *visitor) findFileModes(file *ast.File) {
+	ast.Inspect(file, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.AssignStmt:
+			if len(node.Rhs) == 1 && len(node.Lhs) > 0 {
+				v.recordFileMode(node.Lhs[0], node.Rhs[0])
+			}
+		case *ast.ValueSpec:
+			if len(node.Values) == 1 && len(node.Names) > 0 {
+				v.recordFileMode(node.Names[0], node.Values[0])
+			}
+		}
+		return true
+	})
+}
+
+func (v *visitor) recordFileMode(lhs, rhs ast.Expr) {
+	id, ok := lhs.(*ast.Ident)
+	if !ok {
+		return
+	}
+	obj, ok := v.pkg.TypesInfo.ObjectOf(id).(*types.Var)
+	if !ok {
+		return
+	}
+	mode := fileUnknown
+	if call, ok := rhs.(*ast.CallExpr); ok {
+		mode = v.fileModeOf(call)
+	}
+	if prev, ok := v.fileModes[obj]; ok && (prev == fileUnknown || prev == fileWritable) {
+		// An unknown or writable assignment cannot be made read-only.
+		if mode != fileWritable {
+			mode = prev
+		}
+	}
+	v.fileModes[obj] = mode
+}
+
+// fileModeOf returns the mode of the file returned by call.
+func (v *visitor) fileModeOf(call *ast.CallExpr) fileMode {
+	name := v.fullName(call)
+	if mode, ok := fileConstructors[name]; ok {
+		return mode
+	}
+	if name != "os.OpenFile" || len(call.Args) < 2 {
+		return fileUnknown
+	}
+	flag := v.pkg.TypesInfo.Types[call.Args[1]].Value
+	if flag == nil || flag.Kind() != constant.Int {
+		return fileUnknown
+	}
+	n, ok := constant.Int64Val(flag)
+	if !ok {
+		return fileUnknown
+	}
+	// The flag values depend on the platform the package is checked for,
+	// so take them from the os package it is type-checked against.
+	_, fn, _ := v.selectorAndFunc(call)
+	wronly, ok1 := packageConst(fn.Pkg(), "O_WRONLY")
+	rdwr, ok2 := packageConst(fn.Pkg(), "O_RDWR")
+	if !ok1 || !ok2 {
+		return fileUnknown
+	}
+	if n&(wronly|rdwr) != 0 {
+		return fileWritable
+	}
+	return fileReadOnly
+}
+
+// packageConst returns the value of the integer constant name declared in pkg.
+func packageConst(pkg *types.Package, name string) (int64, bool) {
+	c, ok := pkg.Scope().Lookup(name).(*types.Const)
+	if !ok {
+		return 0, false
+	}
+	return constant.Int64Val(c.Val())
+}
+
+// deferredCallRule returns the rule suppressing the deferred call, as
+// described by suppressedBy, and a message explaining why it is reported,
+// if any. If deferred closes are checked by file mode, those of read-only
+// files are suppressed and those of writable files explained.
+func (v *visitor) deferredCallRule(call *ast.CallExpr) (rule, message string) {
+	rule = v.suppressedBy(call)
+	if rule != "" || !v.deferClose {
+		return rule, ""
+	}
+	switch v.deferredCloseMode(call) {
+	case fileReadOnly:
+		return "deferclose: read-only file", ""
+	case fileWritable:
+		return "", writableCloseMessage
+	}
+	return "", ""
+}
+
+// deferredCloseMode returns the mode of the file closed by the deferred call,
+// or fileUnknown if it is not a Close method call on a traced variable.
+func (v *visitor) deferredCloseMode(call *ast.CallExpr) fileMode {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Close" {
+		return fileUnknown
+	}
+	id, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return fileUnknown
+	}
+	obj, ok := v.pkg.TypesInfo.Uses[id].(*types.Var)
+	if !ok {
+		return fileUnknown
+	}
+	return v.fileModes[obj]
+}
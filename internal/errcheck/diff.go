@@ -0,0 +1,336 @@
+package errcheck
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Changes records the lines added or modified by a diff. It maps absolute
+// file paths, with symbolic links resolved, to the set of changed line
+// numbers in the new version of each file.
+type Changes map[string]map[int]bool
+
+// Contains reports whether the given position lies on a changed line.
+func (c Changes) Contains(pos token.Position) bool {
+	filename, err := filepath.Abs(pos.Filename)
+	if err != nil {
+		filename = pos.Filename
+	}
+	return c[resolvePath(filename)][pos.Line]
+}
+
+// resolvePath returns the absolute path name with symbolic links resolved,
+// or name itself if it cannot be resolved. git resolves the links in the
+// paths it reports, while go/packages keeps those of the working directory.
+func resolvePath(name string) string {
+	if resolved, err := filepath.EvalSymlinks(name); err == nil {
+		return resolved
+	}
+	return name
+}
+
+func (c Changes) add(filename string, line int) {
+	lines, ok := c[filename]
+	if !ok {
+		lines = make(map[int]bool)
+		c[filename] = lines
+	}
+	lines[line] = true
+}
+
+// ParseDiff parses a unified diff and returns the lines it adds or modifies.
+// Relative file names in the diff are resolved against dir. The "a/" and "b/"
+// prefixes written by git are stripped, as are the quotes around the names
+// git quotes.
+func ParseDiff(r io.Reader, dir string) (Changes, error) {
+	changes := make(Changes)
+
+	var (
+		filename string
+
+		// oldName is the name in the last "---" header, and gitPrefixes
+		// reports whether the current file of a git diff has its names
+		// prefixed by "a/" and "b/".
+		oldName     string
+		gitPrefixes bool
+
+		// The next line number in the new file and the number of
+		// lines of the current hunk that are yet to be read.
+		line, oldLeft, newLeft int
+	)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		text := scanner.Text()
+		if oldLeft > 0 || newLeft > 0 {
+			switch {
+			case strings.HasPrefix(text, "+"):
+				if filename != "" {
+					changes.add(filename, line)
+				}
+				line++
+				newLeft--
+			case strings.HasPrefix(text, "-"):
+				oldLeft--
+			case strings.HasPrefix(text, `\`):
+				// "\ No newline at end of file"
+			default:
+				line++
+				oldLeft--
+				newLeft--
+			}
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(text, "diff "):
+			// Each file of a git diff starts with a "diff --git" line, and
+			// each file of a recursive diff with the diff command line.
+			gitPrefixes = strings.HasPrefix(text, "diff --git a/") || strings.HasPrefix(text, `diff --git "a/`)
+		case strings.HasPrefix(text, "--- "):
+			oldName = headerName(text[len("--- "):])
+		case strings.HasPrefix(text, "+++ "):
+			filename = diffFilename(oldName, headerName(text[len("+++ "):]), gitPrefixes, dir)
+		case strings.HasPrefix(text, "@@ "):
+			var err error
+			line, oldLeft, newLeft, err = parseHunkHeader(text)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// headerName returns the file name in a "---" or "+++" header.
+func headerName(name string) string {
+	if strings.HasPrefix(name, `"`) {
+		// git quotes names with special characters using C-style escapes.
+		if q, err := strconv.QuotedPrefix(name); err == nil {
+			if unquoted, err := strconv.Unquote(q); err == nil {
+				return unquoted
+			}
+		}
+	}
+	if i := strings.IndexByte(name, '\t'); i != -1 {
+		// Strip the timestamp written by diff -u.
+		name = name[:i]
+	}
+	return name
+}
+
+// diffFilename returns the absolute path of the file named name in a "+++"
+// header following a "---" header naming oldName, with symbolic links
+// resolved, or the empty string if the file was deleted. The "b/" prefix of
+// name is stripped if the diff is a git diff with prefixes, or if the names
+// are an "a/" and "b/" pair of the same path.
+func diffFilename(oldName, name string, gitPrefixes bool, dir string) string {
+	if name == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(name, "b/") && (gitPrefixes || strings.HasPrefix(oldName, "a/") && oldName[2:] == name[2:]) {
+		name = name[2:]
+	}
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(dir, name)
+	}
+	return resolvePath(filepath.Clean(name))
+}
+
+// parseHunkHeader parses a header of the form "@@ -l,s +l,s @@" and returns
+// the first line of the hunk in the new file along with the number of lines
+// the hunk spans in the old and new files.
+func parseHunkHeader(header string) (line, oldCount, newCount int, err error) {
+	fields := strings.Fields(header)
+	if len(fields) < 3 || !strings.HasPrefix(fields[1], "-") || !strings.HasPrefix(fields[2], "+") {
+		return 0, 0, 0, fmt.Errorf("malformed hunk header: %q", header)
+	}
+	_, oldCount, err = parseRange(fields[1][1:])
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("malformed hunk header: %q", header)
+	}
+	line, newCount, err = parseRange(fields[2][1:])
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("malformed hunk header: %q", header)
+	}
+	return line, oldCount, newCount, nil
+}
+
+// parseRange parses a hunk range of the form "l,s" or "l", where the
+// count s defaults to 1.
+func parseRange(r string) (start, count int, err error) {
+	parts := strings.SplitN(r, ",", 2)
+	start, err = strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	count = 1
+	if len(parts) == 2 {
+		count, err = strconv.Atoi(parts[1])
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	return start, count, nil
+}
+
+// GitChanges returns the lines of the working tree that were added or
+// modified relative to the given git revision.
+func GitChanges(rev string) (Changes, error) {
+	return gitDiff(rev)
+}
+
+// gitDiff runs git diff with the given arguments in the top-level directory
+// of the current repository and parses its output.
+func gitDiff(args ...string) (Changes, error) {
+	root, err := gitTopLevel()
+	if err != nil {
+		return nil, err
+	}
+	args = append([]string{"diff", "-U0", "--no-color", "--no-ext-diff", "--src-prefix=a/", "--dst-prefix=b/"}, args...)
+	args = append(args, "--")
+	out, err := git(root, args...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseDiff(bytes.NewReader(out), root)
+}
+
+// gitTopLevel returns the top-level directory of the current git repository.
+// git resolves the symbolic links in the path, so the directory is returned
+// relative to the working directory when it leads there, to match the file
+// names reported by go/packages.
+func gitTopLevel() (string, error) {
+	out, err := git("", "rev-parse", "--show-toplevel", "--show-cdup")
+	if err != nil {
+		return "", err
+	}
+	lines := strings.SplitN(string(out), "\n", 3)
+	root := lines[0]
+	wd, err := os.Getwd()
+	if err != nil || len(lines) < 2 {
+		return root, nil
+	}
+	// The up-level path is joined lexically, which leads elsewhere if the
+	// working directory is a link into a subdirectory of the repository.
+	if dir := filepath.Join(wd, lines[1]); resolvePath(dir) == resolvePath(root) {
+		return dir, nil
+	}
+	return root, nil
+}
+
+// git runs the git binary in dir and returns its standard output.
+func git(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// Staged describes the Go files staged in the git index of the current repository.
+type Staged struct {
+	// Changes holds the lines added or modified by the staged hunks.
+	Changes Changes
+
+	// Overlay maps the absolute path of every indexed Go file in Dirs to its
+	// staged contents, and that of every other Go file in Dirs to a file
+	// excluded from builds, suitable for Checker.Overlay.
+	Overlay map[string][]byte
+
+	// Dirs lists the absolute paths of the directories containing staged Go files.
+	Dirs []string
+}
+
+// GitStaged reads the staged Go files and hunks from the git index.
+func GitStaged() (*Staged, error) {
+	root, err := gitTopLevel()
+	if err != nil {
+		return nil, err
+	}
+	changes, err := gitDiff("--cached")
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := git(root, "diff", "--cached", "--name-only", "-z", "--diff-filter=ACMR", "--", "*.go")
+	if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	seen := make(map[string]bool)
+	for _, name := range splitNul(out) {
+		dir := filepath.Dir(name)
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+
+	s := &Staged{Changes: changes, Overlay: make(map[string][]byte)}
+	for _, dir := range dirs {
+		s.Dirs = append(s.Dirs, filepath.Join(root, dir))
+
+		// Overlay every indexed file of the package, not only the staged
+		// ones, so that unstaged edits to its other files are not checked.
+		out, err := git(root, "ls-files", "--cached", "-z", "--", dir+"/*.go")
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range splitNul(out) {
+			if filepath.Dir(name) != dir {
+				continue
+			}
+			src, err := git(root, "show", ":"+name)
+			if err != nil {
+				return nil, err
+			}
+			s.Overlay[filepath.Join(root, name)] = src
+		}
+
+		// Hide the untracked files and those deleted in the index, which
+		// are not part of the commit.
+		infos, err := ioutil.ReadDir(filepath.Join(root, dir))
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			file := filepath.Join(root, dir, info.Name())
+			if info.IsDir() || !strings.HasSuffix(file, ".go") {
+				continue
+			}
+			if _, ok := s.Overlay[file]; !ok {
+				s.Overlay[file] = ignoredFile
+			}
+		}
+	}
+	return s, nil
+}
+
+// ignoredFile is the content overlaid on files that must not be checked.
+var ignoredFile = []byte("//go:build ignore\n\npackage ignored\n")
+
+func splitNul(b []byte) []string {
+	var names []string
+	for _, name := range strings.Split(string(b), "\x00") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
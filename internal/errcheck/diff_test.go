@@ -0,0 +1,209 @@
+package errcheck
+
+import (
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testDiff = `diff --git a/main.go b/main.go
+index de98044..a7bc997 100644
+--- a/main.go
++++ b/main.go
+@@ -2 +2 @@ package main
+-	a()
++	b()
+@@ -10,0 +11,2 @@ func main() {
++	c()
++++ d()
+@@ -20,3 +22,3 @@ func f() {
+ 	x()
+-	y()
++	z()
+ 	w()
+\ No newline at end of file
+diff --git a/gone.go b/gone.go
+deleted file mode 100644
+--- a/gone.go
++++ /dev/null
+@@ -1 +0,0 @@
+-package main
+`
+
+func TestParseDiff(t *testing.T) {
+	changes, err := ParseDiff(strings.NewReader(testDiff), "/src")
+	if err != nil {
+		t.Fatalf("ParseDiff failed: %v", err)
+	}
+
+	cases := []struct {
+		file    string
+		line    int
+		changed bool
+	}{
+		{"/src/main.go", 1, false},
+		{"/src/main.go", 2, true},
+		{"/src/main.go", 3, false},
+		{"/src/main.go", 11, true},
+		{"/src/main.go", 12, true},
+		{"/src/main.go", 13, false},
+		{"/src/main.go", 22, false},
+		{"/src/main.go", 23, true},
+		{"/src/main.go", 24, false},
+		{"/src/gone.go", 1, false},
+	}
+	for _, c := range cases {
+		pos := token.Position{Filename: c.file, Line: c.line}
+		if got := changes.Contains(pos); got != c.changed {
+			t.Errorf("%s:%d: changed got %v want %v", c.file, c.line, got, c.changed)
+		}
+	}
+	if len(changes) != 1 {
+		t.Errorf("got changes for %d files, want 1", len(changes))
+	}
+}
+
+func TestParseDiffNames(t *testing.T) {
+	cases := []struct {
+		diff string
+		file string
+	}{
+		// diff -u of a file whose path starts with b/
+		{"--- b/x.go\t2024-01-01 00:00:00\n+++ b/x.go\t2024-01-02 00:00:00\n@@ -1 +1 @@\n-a\n+b\n", "/src/b/x.go"},
+		// diff -u of two directories named a and b
+		{"--- a/x.go\n+++ b/x.go\n@@ -1 +1 @@\n-a\n+b\n", "/src/x.go"},
+		// git diff of a new file
+		{"diff --git a/x.go b/x.go\nnew file mode 100644\n--- /dev/null\n+++ b/x.go\n@@ -0,0 +1 @@\n+b\n", "/src/x.go"},
+		// git diff without prefixes
+		{"diff --git b/x.go b/x.go\n--- b/x.go\n+++ b/x.go\n@@ -1 +1 @@\n-a\n+b\n", "/src/b/x.go"},
+		// git diff of a file with a quoted name
+		{"diff --git \"a/na\\303\\257ve.go\" \"b/na\\303\\257ve.go\"\n--- \"a/na\\303\\257ve.go\"\n+++ \"b/na\\303\\257ve.go\"\n@@ -1 +1 @@\n-a\n+b\n", "/src/naïve.go"},
+	}
+	for _, c := range cases {
+		changes, err := ParseDiff(strings.NewReader(c.diff), "/src")
+		if err != nil {
+			t.Fatalf("ParseDiff failed: %v", err)
+		}
+		if !changes.Contains(token.Position{Filename: c.file, Line: 1}) {
+			t.Errorf("%q: got changes %v, want %s:1", c.diff, changes, c.file)
+		}
+	}
+}
+
+// TestGitChangesSymlink ensures that changes are found in files named
+// through a symbolic link to the repository, which git resolves.
+func TestGitChangesSymlink(t *testing.T) {
+	defer testGitRepo(t, map[string]string{"a.go": "package a\n"})()
+	writeTestFile(t, "a.go", "package a\n\nfunc f() {}\n")
+	repo, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Getwd failed: %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "testgitlink")
+	if err != nil {
+		t.Fatalf("unable to create testgitlink directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	link := filepath.Join(dir, "repo")
+	if err := os.Symlink(repo, link); err != nil {
+		t.Skipf("Symlink failed: %v", err)
+	}
+	if err := os.Chdir(link); err != nil {
+		t.Fatalf("Chdir failed: %v", err)
+	}
+
+	changes, err := GitChanges("HEAD")
+	if err != nil {
+		t.Fatalf("GitChanges failed: %v", err)
+	}
+	if pos := (token.Position{Filename: filepath.Join(link, "a.go"), Line: 3}); !changes.Contains(pos) {
+		t.Errorf("got changes %v, want %s:%d", changes, pos.Filename, pos.Line)
+	}
+}
+
+// testGitRepo creates a git repository in a temporary directory containing
+// the given files, committed, and changes to it. The returned function
+// removes it and restores the current directory.
+func testGitRepo(t *testing.T, files map[string]string) func() {
+	dir, err := ioutil.TempDir("", "testgitrepo")
+	if err != nil {
+		t.Fatalf("unable to create testgitrepo directory: %v", err)
+	}
+	// TempDir may be a symbolic link, while git reports resolved paths.
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		t.Fatalf("EvalSymlinks failed: %v", err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Getwd failed: %v", err)
+	}
+	cleanup := func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	}
+	if err := os.Chdir(dir); err != nil {
+		cleanup()
+		t.Fatalf("Chdir failed: %v", err)
+	}
+	for name, src := range files {
+		writeTestFile(t, name, src)
+	}
+	testGit(t, "init", "-q")
+	testGit(t, "add", ".")
+	testGit(t, "-c", "user.name=errcheck", "-c", "user.email=errcheck@example.com", "commit", "-q", "-m", "initial")
+	return cleanup
+}
+
+func writeTestFile(t *testing.T, name, src string) {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	if err := ioutil.WriteFile(name, []byte(src), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+}
+
+func testGit(t *testing.T, args ...string) {
+	if _, err := git("", args...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGitChanges(t *testing.T) {
+	defer testGitRepo(t, map[string]string{
+		"a.go":     "package a\n\nfunc f() {}\n",
+		"b/b b.go": "package b\n",
+	})()
+	writeTestFile(t, "a.go", "package a\n\nfunc f() {}\n\nfunc g() {}\n")
+	writeTestFile(t, "b/b b.go", "package b\n\nfunc h() {}\n")
+
+	changes, err := GitChanges("HEAD")
+	if err != nil {
+		t.Fatalf("GitChanges failed: %v", err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Getwd failed: %v", err)
+	}
+	cases := []struct {
+		file    string
+		line    int
+		changed bool
+	}{
+		{"a.go", 3, false},
+		{"a.go", 4, true},
+		{"a.go", 5, true},
+		{"b/b b.go", 1, false},
+		{"b/b b.go", 3, true},
+	}
+	for _, c := range cases {
+		pos := token.Position{Filename: filepath.Join(wd, c.file), Line: c.line}
+		if got := changes.Contains(pos); got != c.changed {
+			t.Errorf("%s:%d: changed got %v want %v", c.file, c.line, got, c.changed)
+		}
+	}
+}
@@ -4,16 +4,18 @@
 package errcheck
 
 import (
-	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"go/ast"
+	"go/printer"
 	"go/token"
 	"go/types"
+	"io/ioutil"
 	"os"
-	"os/exec"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -37,6 +39,97 @@ type UncheckedError struct {
 	Pos      token.Position
 	Line     string
 	FuncName string
+
+	// Mapped and Physical are the position of the error as mapped by //line
+	// directives and its position in the Go file. Pos is Mapped unless the
+	// Checker ignores line directives. Line is always read from the Go file.
+	Mapped   token.Position
+	Physical token.Position
+
+	// Package is the import path of the package containing the error.
+	Package string
+
+	// Start and End delimit the call or type assertion leaving the error
+	// unchecked, and are Pos if there is none.
+	Start token.Position
+	End   token.Position
+
+	// Expr is the source text of the call or type assertion leaving the
+	// error unchecked, which may span several lines. ExprLine is the same
+	// expression printed on one line, without comments.
+	Expr     string
+	ExprLine string
+
+	// Kind is the kind of code the error is left unchecked by.
+	Kind ErrorKind
+
+	// EnclosingFunc is the full name of the function declaration containing
+	// the error, such as "(*os.File).Close", or the empty string if the error
+	// is outside of any function declaration.
+	EnclosingFunc string
+
+	// Signature is the type of the function called, such as
+	// "func(name string) error", if the error is left unchecked by a call.
+	Signature string
+
+	// Dropped lists the results whose errors are left unchecked. For an
+	// unchecked type assertion, it is its ok result.
+	Dropped []DroppedResult
+
+	// Go and Defer report whether the call is in a go or defer statement.
+	Go    bool
+	Defer bool
+
+	// Configs lists the build configurations the error is found in, as
+	// described by BuildConfig.String and sorted, if Checker.Configs is set.
+	Configs []string
+
+	// ExcludeName is the name an exclude entry must have to exclude the
+	// call, in the format checked by namesForExcludeCheck, or the empty
+	// string if the error cannot be excluded by name, such as for calls of
+	// function values and type assertions.
+	ExcludeName string
+
+	// Message optionally explains why the error is reported.
+	Message string
+
+	// SuppressedBy describes the rule that suppressed the error, such as
+	// "default-exclude: fmt.Printf", if the error was not reported.
+	SuppressedBy string
+}
+
+// DroppedResult is a result of a call or type assertion whose error is left unchecked.
+type DroppedResult struct {
+	Index int
+	Type  string
+}
+
+// ErrorKind is the kind of code an unchecked error is found in.
+type ErrorKind int
+
+const (
+	// UncheckedCall is a call whose error result is discarded.
+	UncheckedCall ErrorKind = iota
+	// BlankAssignment is a call whose error result is assigned to the blank identifier.
+	BlankAssignment
+	// UncheckedAssertion is a type assertion whose ok result is discarded.
+	UncheckedAssertion
+	// UncheckedIterator is an iterator advanced without consulting its deferred error.
+	UncheckedIterator
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case UncheckedCall:
+		return "call"
+	case BlankAssignment:
+		return "blank"
+	case UncheckedAssertion:
+		return "assert"
+	case UncheckedIterator:
+		return "iterator"
+	}
+	return "ErrorKind(" + strconv.Itoa(int(k)) + ")"
 }
 
 // UncheckedErrors is returned from the CheckPackage function if the package contains
@@ -48,6 +141,12 @@ type UncheckedErrors struct {
 	// Errors is a list of all the unchecked errors in the package.
 	// Printing an error reports its position within the file and the contents of the line.
 	Errors []UncheckedError
+
+	// Suppressed is a list of the unchecked errors that were not reported
+	// because of an exclude or ignore rule. It is only populated if
+	// Checker.ShowSuppressed is set; as CheckPackages returns no error if
+	// all errors are suppressed, use Result.Suppressed to list them always.
+	Suppressed []UncheckedError
 }
 
 func (e *UncheckedErrors) Append(errors ...UncheckedError) {
@@ -56,6 +155,31 @@ func (e *UncheckedErrors) Append(errors ...UncheckedError) {
 	e.Errors = append(e.Errors, errors...)
 }
 
+// AppendSuppressed appends to the list of suppressed errors. It is safe to use concurrently.
+func (e *UncheckedErrors) AppendSuppressed(errors ...UncheckedError) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.Suppressed = append(e.Suppressed, errors...)
+}
+
+// Filter removes the errors and suppressed errors for which keep returns false.
+func (e *UncheckedErrors) Filter(keep func(UncheckedError) bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.Errors = filterErrors(e.Errors, keep)
+	e.Suppressed = filterErrors(e.Suppressed, keep)
+}
+
+func filterErrors(errors []UncheckedError, keep func(UncheckedError) bool) []UncheckedError {
+	kept := errors[:0] // compact in-place
+	for _, err := range errors {
+		if keep(err) {
+			kept = append(kept, err)
+		}
+	}
+	return kept
+}
+
 func (e *UncheckedErrors) Error() string {
 	return fmt.Sprintf("%d unchecked errors", len(e.Errors))
 }
@@ -66,12 +190,31 @@ func (e *UncheckedErrors) Len() int { return len(e.Errors) }
 // Swap swaps the elements with indexes i and j.
 func (e *UncheckedErrors) Swap(i, j int) { e.Errors[i], e.Errors[j] = e.Errors[j], e.Errors[i] }
 
-type byName struct{ *UncheckedErrors }
+// sortErrors sorts errors by position and removes duplicates. Duplicates may
+// occur when a file containing an unchecked error belongs to > 1 package.
+func sortErrors(errors []UncheckedError) []UncheckedError {
+	sort.Slice(errors, func(i, j int) bool { return lessError(errors[i], errors[j]) })
+	uniq := errors[:0] // compact in-place
+	for i, err := range errors {
+		if i > 0 && sameError(err, uniq[len(uniq)-1]) {
+			last := &uniq[len(uniq)-1]
+			last.Configs = sortedUnion(last.Configs, err.Configs)
+			continue
+		}
+		uniq = append(uniq, err)
+	}
+	return uniq
+}
 
-// Less reports whether the element with index i should sort before the element with index j.
-func (e byName) Less(i, j int) bool {
-	ei, ej := e.Errors[i], e.Errors[j]
+// sameError reports whether ei and ej are the same error, as reported for
+// a file belonging to several packages or checked in several configurations.
+func sameError(ei, ej UncheckedError) bool {
+	return ei.Pos == ej.Pos && ei.End == ej.End && ei.Kind == ej.Kind &&
+		ei.Message == ej.Message && ei.SuppressedBy == ej.SuppressedBy
+}
 
+// lessError reports whether ei should sort before ej.
+func lessError(ei, ej UncheckedError) bool {
 	pi, pj := ei.Pos, ej.Pos
 
 	if pi.Filename != pj.Filename {
@@ -88,6 +231,9 @@ func (e byName) Less(i, j int) bool {
 }
 
 type Checker struct {
+	// mu guards the exclude rules, which runs copy with excludeRules.
+	mu sync.RWMutex
+
 	// ignore is a map of package names to regular expressions. Identifiers from a package are
 	// checked against its regular expressions and if any of the expressions match the call
 	// is not checked.
@@ -103,72 +249,159 @@ type Checker struct {
 	// build tags
 	Tags []string
 
+	// Configs are the build configurations to check packages in, such as
+	// different platforms or sets of tags. If empty, packages are checked
+	// once, for the platform of the environment. Errors found in several
+	// configurations are reported once, listing them in their Configs.
+	Configs []BuildConfig
+
+	// Verbose logs the packages being checked to stderr, unless Logger is set.
 	Verbose bool
 
+	// Logger, if set, receives the log messages of every level, explaining
+	// how packages are loaded and calls excluded or ignored.
+	Logger Logger
+
 	// If true, checking of _test.go files is disabled
 	WithoutTests bool
 
 	// If true, checking of files with generated code is disabled
 	WithoutGeneratedCode bool
 
-	exclude map[string]bool
+	// If true, errors are reported at their physical positions in the Go
+	// files rather than at the positions //line directives map them to.
+	IgnoreLineDirectives bool
+
+	// If true, functions that advance an iterator of one of IteratorTypes
+	// without consulting its deferred error are reported
+	Iterators bool
+
+	// IteratorTypes lists the iterator types checked when Iterators is set.
+	// NewChecker initializes it to DefaultIteratorTypes.
+	IteratorTypes []IteratorType
+
+	// If true, the receivers of deferred Close calls are traced back to
+	// their constructors: closes of read-only files are not reported, and
+	// closes of writable files are reported with an explanation.
+	DeferClose bool
+
+	// Checks are run on every node of the checked files in addition to the
+	// built-in checks. See Check.
+	Checks []Check
+
+	// Overlay maps absolute file paths to contents that replace the contents
+	// of those files on disk, as in packages.Config.Overlay.
+	Overlay map[string][]byte
+
+	// If true, calls suppressed by an exclude or ignore rule are collected
+	// in Result.Suppressed and UncheckedErrors.Suppressed
+	ShowSuppressed bool
+
+	excludeProfile string
+	userExclude    map[string]bool
+	exclude        map[string]bool
+	defaultExclude map[string]string // entry -> profile
+	excludeArgs    map[string][]argCondition
+	excludeFuncs   []namedExcludeFunc
+	sticky         []stickyType
 }
 
 func NewChecker() *Checker {
-	c := Checker{}
+	c := Checker{IteratorTypes: DefaultIteratorTypes}
 	c.SetExclude(map[string]bool{})
 	return &c
 }
 
+// SetExclude sets the functions excluded from checking, in addition to those
+// of the selected exclude profile.
 func (c *Checker) SetExclude(l map[string]bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.setExclude(l)
+}
+
+func (c *Checker) setExclude(l map[string]bool) {
+	c.userExclude = l
 	c.exclude = map[string]bool{}
+	c.defaultExclude = map[string]string{}
 
-	// Default exclude for stdlib functions
-	for _, exc := range []string{
-		// bytes
-		"(*bytes.Buffer).Write",
-		"(*bytes.Buffer).WriteByte",
-		"(*bytes.Buffer).WriteRune",
-		"(*bytes.Buffer).WriteString",
-
-		// fmt
-		"fmt.Errorf",
-		"fmt.Print",
-		"fmt.Printf",
-		"fmt.Println",
-		"fmt.Fprint(*bytes.Buffer)",
-		"fmt.Fprintf(*bytes.Buffer)",
-		"fmt.Fprintln(*bytes.Buffer)",
-		"fmt.Fprint(*strings.Builder)",
-		"fmt.Fprintf(*strings.Builder)",
-		"fmt.Fprintln(*strings.Builder)",
-		"fmt.Fprint(os.Stderr)",
-		"fmt.Fprintf(os.Stderr)",
-		"fmt.Fprintln(os.Stderr)",
-
-		// math/rand
-		"math/rand.Read",
-		"(*math/rand.Rand).Read",
-
-		// strings
-		"(*strings.Builder).Write",
-		"(*strings.Builder).WriteByte",
-		"(*strings.Builder).WriteRune",
-		"(*strings.Builder).WriteString",
-
-		// hash
-		"(hash.Hash).Write",
-	} {
+	entries, _ := profileEntries(c.excludeProfile)
+	for exc, profile := range entries {
 		c.exclude[exc] = true
+		c.defaultExclude[exc] = profile
 	}
 
 	for k := range l {
 		c.exclude[k] = true
+		delete(c.defaultExclude, k)
+	}
+
+	c.excludeArgs = map[string][]argCondition{}
+	c.sticky = nil
+	for k := range c.exclude {
+		if name, cond, ok := parseArgExclude(k); ok {
+			cond.entry = k
+			c.excludeArgs[name] = append(c.excludeArgs[name], cond)
+		}
+		if st, ok := parseStickyType(k); ok {
+			c.sticky = append(c.sticky, st)
+		}
 	}
 }
 
-func (c *Checker) logf(msg string, args ...interface{}) {
-	if c.Verbose {
+// SetExcludeProfile selects the built-in exclude profile that functions set
+// with SetExclude are added to. See ExcludeProfiles for the available profiles.
+func (c *Checker) SetExcludeProfile(name string) error {
+	if _, err := profileEntries(name); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.excludeProfile = name
+	c.setExclude(c.userExclude)
+	return nil
+}
+
+// AddExcludeFunc adds a predicate deciding whether calls are excluded from
+// checking. It is consulted for the calls of resolved functions that are not
+// excluded by the exclude list, and the calls it excludes are suppressed by
+// the rule "exclude-func: NAME". It may be called concurrently for calls in
+// different packages.
+func (c *Checker) AddExcludeFunc(name string, f ExcludeFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.excludeFuncs = append(c.excludeFuncs, namedExcludeFunc{name: name, f: f})
+}
+
+// ExcludeEntry is an entry of the effective exclude list.
+type ExcludeEntry struct {
+	Name string
+
+	// Source is the name of the built-in profile the entry comes from, or
+	// "exclude" if it was set with SetExclude.
+	Source string
+}
+
+// Excludes returns the effective exclude list, sorted by name.
+func (c *Checker) Excludes() []ExcludeEntry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entries := make([]ExcludeEntry, 0, len(c.exclude))
+	for name := range c.exclude {
+		source, ok := c.defaultExclude[name]
+		if !ok {
+			source = "exclude"
+		}
+		entries = append(entries, ExcludeEntry{Name: name, Source: source})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries
+}
+
+func (c *Checker) logf(level LogLevel, msg string, args ...interface{}) {
+	if c.Logger != nil {
+		c.Logger.Logf(level, msg, args...)
+	} else if c.Verbose && level == LogInfo {
 		fmt.Fprintf(os.Stderr, msg+"\n", args...)
 	}
 }
@@ -178,13 +411,24 @@ var loadPackages = func(cfg *packages.Config, paths ...string) ([]*packages.Pack
 	return packages.Load(cfg, paths...)
 }
 
-func (c *Checker) load(paths ...string) ([]*packages.Package, error) {
+// load loads the packages matching paths in config, which are relative to
+// dir if it is not empty, and to the current directory otherwise.
+func (c *Checker) load(dir string, config BuildConfig, paths ...string) ([]*packages.Package, error) {
+	tags := append(append([]string{}, c.Tags...), config.Tags...)
 	cfg := &packages.Config{
-		Mode:       packages.LoadAllSyntax,
+		Dir:        dir,
+		Mode:       packages.LoadAllSyntax | packages.NeedModule,
 		Tests:      !c.WithoutTests,
-		BuildFlags: []string{fmt.Sprintf("-tags=%s", strings.Join(c.Tags, " "))},
+		BuildFlags: []string{fmt.Sprintf("-tags=%s", strings.Join(tags, " "))},
+		Env:        config.env(),
+		Overlay:    c.Overlay,
+	}
+	c.logf(LogDebug, "loading %s for %s with tests %v, build flags %q and %d overlaid files", paths, config, cfg.Tests, cfg.BuildFlags, len(cfg.Overlay))
+	pkgs, err := loadPackages(cfg, paths...)
+	if err == nil {
+		c.logf(LogDebug, "loaded %d packages", len(pkgs))
 	}
-	return loadPackages(cfg, paths...)
+	return pkgs, err
 }
 
 var generatedCodeRegexp = regexp.MustCompile("^// Code generated .* DO NOT EDIT\\.$")
@@ -205,121 +449,201 @@ func (c *Checker) shouldSkipFile(file *ast.File) bool {
 	return false
 }
 
-// CheckPackages checks packages for errors.
-func (c *Checker) CheckPackages(paths ...string) error {
-	pkgs, err := c.load(paths...)
-	if err != nil {
-		return err
+// ignoreMap returns the ignore patterns to use for pkg. In a module, vendored
+// packages have unvendored paths, so the patterns are keyed by their
+// unvendored package paths too.
+func (c *Checker) ignoreMap(pkg *packages.Package) map[string]*regexp.Regexp {
+	if pkg.Module == nil {
+		c.logf(LogDebug, "package %s is not in a module, using GOPATH mode", pkg.ID)
+		return c.Ignore
 	}
-	// Check for errors in the initial packages.
-	for _, pkg := range pkgs {
-		if len(pkg.Errors) > 0 {
-			return fmt.Errorf("errors while loading package %s: %v", pkg.ID, pkg.Errors)
+	c.logf(LogDebug, "package %s is in module %s", pkg.ID, pkg.Module.Path)
+	ignore := make(map[string]*regexp.Regexp)
+	for path, re := range c.Ignore {
+		if nonVendoredPkg, ok := nonVendoredPkgPath(path); ok {
+			ignore[nonVendoredPkg] = re
+		} else {
+			ignore[path] = re
 		}
 	}
+	return ignore
+}
 
-	gomod, err := exec.Command("go", "env", "GOMOD").Output()
-	go111module := (err == nil) && strings.TrimSpace(string(gomod)) != ""
-	ignore := c.Ignore
-	if go111module {
-		ignore = make(map[string]*regexp.Regexp)
-		for pkg, re := range c.Ignore {
-			if nonVendoredPkg, ok := nonVendoredPkgPath(pkg); ok {
-				ignore[nonVendoredPkg] = re
-			} else {
-				ignore[pkg] = re
-			}
-		}
+// excludeRules are the exclude rules of a Checker, as used by a run.
+type excludeRules struct {
+	exclude        map[string]bool
+	defaultExclude map[string]string
+	excludeArgs    map[string][]argCondition
+	excludeFuncs   []namedExcludeFunc
+	sticky         []stickyType
+}
+
+// excludeRules returns the current exclude rules. The methods changing them
+// replace the maps and append to the slices rather than modifying them, so
+// the rules returned stay valid after c.mu is released.
+func (c *Checker) excludeRules() excludeRules {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return excludeRules{
+		exclude:        c.exclude,
+		defaultExclude: c.defaultExclude,
+		excludeArgs:    c.excludeArgs,
+		excludeFuncs:   c.excludeFuncs,
+		sticky:         c.sticky,
 	}
+}
 
-	var wg sync.WaitGroup
-	u := &UncheckedErrors{}
-	for _, pkg := range pkgs {
-		wg.Add(1)
-
-		go func(pkg *packages.Package) {
-			defer wg.Done()
-			c.logf("Checking %s", pkg.Types.Path())
-
-			v := &visitor{
-				pkg:         pkg,
-				ignore:      ignore,
-				blank:       c.Blank,
-				asserts:     c.Asserts,
-				lines:       make(map[string][]string),
-				exclude:     c.exclude,
-				go111module: go111module,
-				errors:      []UncheckedError{},
-			}
+func (c *Checker) newVisitor(pkg *packages.Package, rules excludeRules) *visitor {
+	v := &visitor{
+		pkg:            pkg,
+		ignore:         c.ignoreMap(pkg),
+		blank:          c.Blank,
+		asserts:        c.Asserts,
+		lines:          make(map[string][]string),
+		sources:        make(map[string][]byte),
+		overlay:        c.Overlay,
+		exclude:        rules.exclude,
+		defaultExclude: rules.defaultExclude,
+		excludeArgs:    rules.excludeArgs,
+		excludeFuncs:   rules.excludeFuncs,
+		iterators:      c.IteratorTypes,
+		sticky:         rules.sticky,
+		stickyExempt:   make(map[*ast.CallExpr]stickyType),
+		stickyMissing:  make(map[*ast.CallExpr]string),
+		deferClose:     c.DeferClose,
+		fileModes:      make(map[*types.Var]fileMode),
+		go111module:    pkg.Module != nil,
+		showSuppressed: c.ShowSuppressed,
+		logger:         c.Logger,
+		checks:         c.checks(),
+		errors:         []UncheckedError{},
+
+		ignoreLineDirectives: c.IgnoreLineDirectives,
+	}
+	v.pass = &Pass{Pkg: pkg, v: v}
+	return v
+}
 
-			for _, astFile := range v.pkg.Syntax {
-				if c.shouldSkipFile(astFile) {
-					continue
-				}
-				ast.Walk(v, astFile)
-			}
-			u.Append(v.errors...)
-		}(pkg)
-	}
-
-	wg.Wait()
-	if u.Len() > 0 {
-		// Sort unchecked errors and remove duplicates. Duplicates may occur when a file
-		// containing an unchecked error belongs to > 1 package.
-		sort.Sort(byName{u})
-		uniq := u.Errors[:0] // compact in-place
-		for i, err := range u.Errors {
-			if i == 0 || err != u.Errors[i-1] {
-				uniq = append(uniq, err)
-			}
-		}
-		u.Errors = uniq
-		return u
+// prepareFile runs the passes over file that the checks of its calls depend
+// on, finding the sticky writes and, if deferred closes are checked by file
+// mode, the modes of the files opened.
+func (v *visitor) prepareFile(file *ast.File) {
+	v.findStickyWrites(file)
+	if v.deferClose {
+		v.findFileModes(file)
+	}
+}
+
+// CheckPackages checks packages for errors. It returns an *UncheckedErrors
+// if there are unchecked errors, and an error if any package
+// fails to load. See Run for the statistics of the check.
+func (c *Checker) CheckPackages(paths ...string) error {
+	r, err := c.Run(paths...)
+	if err != nil {
+		return err
+	}
+	return r.err()
+}
+
+// CheckModules is like CheckPackages, but checks paths in each of the module
+// directories dirs. See RunModules.
+func (c *Checker) CheckModules(dirs []string, paths ...string) error {
+	r, err := c.RunModules(dirs, paths...)
+	if err != nil {
+		return err
+	}
+	return r.err()
+}
+
+// err returns the error CheckPackages reports for r.
+func (r *Result) err() error {
+	if len(r.Diagnostics) > 0 {
+		return r.Diagnostics[0]
+	}
+	if len(r.Errors) > 0 {
+		return &UncheckedErrors{Errors: r.Errors, Suppressed: r.Suppressed}
 	}
 	return nil
 }
 
 // visitor implements the errcheck algorithm
 type visitor struct {
-	pkg         *packages.Package
-	ignore      map[string]*regexp.Regexp
-	blank       bool
-	asserts     bool
-	lines       map[string][]string
-	exclude     map[string]bool
-	go111module bool
-
-	errors []UncheckedError
+	pkg            *packages.Package
+	ignore         map[string]*regexp.Regexp
+	blank          bool
+	asserts        bool
+	lines          map[string][]string
+	sources        map[string][]byte
+	overlay        map[string][]byte
+	exclude        map[string]bool
+	defaultExclude map[string]string
+	excludeArgs    map[string][]argCondition
+	excludeFuncs   []namedExcludeFunc
+	iterators      []IteratorType
+	go111module    bool
+
+	sticky        []stickyType
+	stickyExempt  map[*ast.CallExpr]stickyType
+	stickyMissing map[*ast.CallExpr]string
+
+	deferClose bool
+	fileModes  map[*types.Var]fileMode
+
+	// ignoreLineDirectives reports errors at their physical positions.
+	ignoreLineDirectives bool
+
+	// showSuppressed collects suppressed calls, and suppressAll, if not
+	// empty, describes the rule suppressing every call in the current file.
+	showSuppressed bool
+	suppressAll    string
+
+	// logger, if not nil, traces the exclude and ignore decisions.
+	logger Logger
+
+	// calls and errorCalls count the calls inspected and those returning an error.
+	calls, errorCalls int
+
+	// checks are run on every node, reporting through pass.
+	checks []Check
+	pass   *Pass
+
+	errors     []UncheckedError
+	suppressed []UncheckedError
 }
 
 // selectorAndFunc tries to get the selector and function from call expression.
 // For example, given the call expression representing "a.b()", the selector
 // is "a.b" and the function is "b" itself.
 //
-// The final return value will be true if it is able to do extract a selector
-// from the call and look up the function object it refers to.
+// The final return value will be true if it is able to look up the function
+// object the call refers to.
 //
-// If the call does not include a selector (like if it is a plain "f()" function call)
-// then the final return value will be false.
+// If the call does not include a selector (like if it is a plain "f()" function call,
+// or a call of a dot-imported function) then the returned selector is nil, and the
+// final return value is true only if the identifier refers to a package-level function.
 func (v *visitor) selectorAndFunc(call *ast.CallExpr) (*ast.SelectorExpr, *types.Func, bool) {
-	sel, ok := call.Fun.(*ast.SelectorExpr)
-	if !ok {
-		return nil, nil, false
-	}
-
-	fn, ok := v.pkg.TypesInfo.ObjectOf(sel.Sel).(*types.Func)
-	if !ok {
-		// Shouldn't happen, but be paranoid
-		return nil, nil, false
+	switch fun := call.Fun.(type) {
+	case *ast.Ident:
+		fn, ok := v.pkg.TypesInfo.Uses[fun].(*types.Func)
+		if !ok {
+			// A local function value, builtin or conversion
+			return nil, nil, false
+		}
+		return nil, fn, true
+	case *ast.SelectorExpr:
+		fn, ok := v.pkg.TypesInfo.ObjectOf(fun.Sel).(*types.Func)
+		if !ok {
+			// Shouldn't happen, but be paranoid
+			return nil, nil, false
+		}
+		return fun, fn, true
 	}
-
-	return sel, fn, true
-
+	return nil, nil, false
 }
 
 // fullName will return a package / receiver-type qualified name for a called function
-// if the function is the result of a selector. Otherwise it will return
-// the empty string.
+// if the function is the result of a selector or names a package-level function.
+// Otherwise it will return the empty string.
 //
 // The name is fully qualified by the import path, possible type,
 // function/method name and pointer receiver.
@@ -327,7 +651,9 @@ func (v *visitor) selectorAndFunc(call *ast.CallExpr) (*ast.SelectorExpr, *types
 // For example,
 //   - for "fmt.Printf(...)" it will return "fmt.Printf"
 //   - for "base64.StdEncoding.Decode(...)" it will return "(*encoding/base64.Encoding).Decode"
-//   - for "myFunc()" it will return ""
+//   - for "Printf(...)", with fmt dot-imported, it will return "fmt.Printf"
+//   - for "myFunc()" it will return "example.com/pkg.myFunc"
+//   - for "f()", where f is a local function value, it will return ""
 func (v *visitor) fullName(call *ast.CallExpr) string {
 	_, fn, ok := v.selectorAndFunc(call)
 	if !ok {
@@ -344,12 +670,14 @@ func (v *visitor) fullName(call *ast.CallExpr) string {
 // namesForExcludeCheck will return a list of fully-qualified function names
 // from a function call that can be used to check against the exclusion list.
 //
-// If a function call is against a local function (like "myFunc()") then no
-// names are returned. If the function is package-qualified (like "fmt.Printf()")
-// then just that function's fullName is returned.
+// If a function call is against a local function value then no names are
+// returned. If the function is package-level (like "fmt.Printf()", a dot-imported
+// "Printf()" or "myFunc()") then just that function's fullName is returned.
 //
 // Otherwise, we walk through all the potentially embeddded interfaces of the receiver
-// the collect a list of type-qualified function names that we will check.
+// the collect a list of type-qualified function names that we will check. If the
+// receiver is a package-level variable or constant, each name is also returned
+// qualified by the receiver, like "(*os.File).Write[os.Stdout]".
 func (v *visitor) namesForExcludeCheck(call *ast.CallExpr) []string {
 	sel, fn, ok := v.selectorAndFunc(call)
 	if !ok {
@@ -360,6 +688,9 @@ func (v *visitor) namesForExcludeCheck(call *ast.CallExpr) []string {
 	if name == "" {
 		return nil
 	}
+	if sel == nil {
+		return []string{name}
+	}
 
 	// This will be missing for functions without a receiver (like fmt.Printf),
 	// so just fall back to the the function's fullName in that case.
@@ -370,59 +701,96 @@ func (v *visitor) namesForExcludeCheck(call *ast.CallExpr) []string {
 
 	// This will return with ok false if the function isn't defined
 	// on an interface, so just fall back to the fullName.
-	ts, ok := walkThroughEmbeddedInterfaces(selection)
-	if !ok {
-		return []string{name}
+	result := []string{name}
+	if ts, ok := walkThroughEmbeddedInterfaces(selection); ok {
+		result = make([]string, len(ts))
+		for i, t := range ts {
+			// Like in fullName, vendored packages will have /vendor/ in their name,
+			// thus not matching vendored standard library packages. If we
+			// want to support vendored stdlib packages, we need to implement
+			// additional logic here.
+			result[i] = fmt.Sprintf("(%s).%s", t.String(), fn.Name())
+		}
 	}
 
-	result := make([]string, len(ts))
-	for i, t := range ts {
-		// Like in fullName, vendored packages will have /vendor/ in their name,
-		// thus not matching vendored standard library packages. If we
-		// want to support vendored stdlib packages, we need to implement
-		// additional logic here.
-		result[i] = fmt.Sprintf("(%s).%s", t.String(), fn.Name())
+	// If the receiver is a package-level variable or constant (like os.Stdout),
+	// the names qualified by it (like "(*os.File).Write[os.Stdout]") are
+	// checked as well.
+	if recv := v.packageLevelName(sel.X); recv != "" {
+		for _, name := range result {
+			result = append(result, name+"["+recv+"]")
+		}
 	}
 	return result
 }
 
-// isBufferType checks if the expression type is a known in-memory buffer type.
-func (v *visitor) argName(expr ast.Expr) string {
-	// Special-case literal "os.Stdout" and "os.Stderr"
-	if sel, ok := expr.(*ast.SelectorExpr); ok {
-		if obj := v.pkg.TypesInfo.ObjectOf(sel.Sel); obj != nil {
-			vr, ok := obj.(*types.Var)
-			if ok && vr.Pkg() != nil && vr.Pkg().Name() == "os" && (vr.Name() == "Stderr" || vr.Name() == "Stdout") {
-				return "os." + vr.Name()
+// excludeRule returns a description of the exclude entry matching call,
+// such as "default-exclude: fmt.Printf", or the empty string if none does.
+func (v *visitor) excludeRule(call *ast.CallExpr) string {
+	names := v.namesForExcludeCheck(call)
+	for _, name := range names {
+		if v.exclude[name] {
+			return v.excludeLabel(name)
+		}
+		for _, cond := range v.excludeArgs[name] {
+			if v.matchArg(call, cond) {
+				return v.excludeLabel(cond.entry)
 			}
 		}
 	}
-	t := v.pkg.TypesInfo.TypeOf(expr)
-	if t == nil {
+
+	if len(v.excludeFuncs) == 0 {
 		return ""
 	}
-	return t.String()
+	if _, fn, ok := v.selectorAndFunc(call); ok {
+		for _, f := range v.excludeFuncs {
+			if f.f(fn, call, names, v.pkg) {
+				return "exclude-func: " + f.name
+			}
+		}
+	}
+	return ""
 }
 
-func (v *visitor) excludeCall(call *ast.CallExpr) bool {
-	var arg0 string
-	if len(call.Args) > 0 {
-		arg0 = v.argName(call.Args[0])
+// excludeLabel describes an exclude entry along with its source.
+func (v *visitor) excludeLabel(entry string) string {
+	if _, ok := v.defaultExclude[entry]; ok {
+		return "default-exclude: " + entry
 	}
-	for _, name := range v.namesForExcludeCheck(call) {
-		if v.exclude[name] {
-			return true
-		}
-		if arg0 != "" && v.exclude[name+"("+arg0+")"] {
-			return true
+	return "exclude: " + entry
+}
+
+func (v *visitor) ignoreCall(call *ast.CallExpr) bool {
+	return v.suppressedBy(call) != ""
+}
+
+// suppressedBy returns a description of the rule that suppresses the
+// checking of call, or the empty string if the call should be checked.
+func (v *visitor) suppressedBy(call *ast.CallExpr) string {
+	rule := v.findSuppression(call)
+	if v.logger != nil {
+		pos := v.pkg.Fset.Position(call.Lparen)
+		if rule == "" {
+			v.logger.Logf(LogTrace, "%s: %s is checked, no rule matches %q", pos, types.ExprString(call.Fun), v.namesForExcludeCheck(call))
+		} else {
+			v.logger.Logf(LogTrace, "%s: %s is suppressed by %s", pos, types.ExprString(call.Fun), rule)
 		}
 	}
-	return false
+	return rule
 }
 
-func (v *visitor) ignoreCall(call *ast.CallExpr) bool {
-	if v.excludeCall(call) {
-		return true
+// findSuppression returns the rule suppressing call, as described by suppressedBy.
+func (v *visitor) findSuppression(call *ast.CallExpr) string {
+	if v.suppressAll != "" {
+		return v.suppressAll
+	}
+
+	if st, ok := v.stickyExempt[call]; ok {
+		return v.excludeLabel(st.entry)
+	}
+
+	if rule := v.excludeRule(call); rule != "" {
+		return rule
 	}
 
 	// Try to get an identifier.
@@ -440,18 +808,18 @@ func (v *visitor) ignoreCall(call *ast.CallExpr) bool {
 	}
 
 	if id == nil {
-		return false
+		return ""
 	}
 
 	// If we got an identifier for the function, see if it is ignored
 	if re, ok := v.ignore[""]; ok && re.MatchString(id.Name) {
-		return true
+		return "ignore: " + re.String()
 	}
 
 	if obj := v.pkg.TypesInfo.Uses[id]; obj != nil {
 		if pkg := obj.Pkg(); pkg != nil {
 			if re, ok := v.ignore[pkg.Path()]; ok {
-				return re.MatchString(id.Name)
+				return ignoreLabel(pkg.Path(), re, id.Name)
 			}
 
 			// if current package being considered is vendored, check to see if it should be ignored based
@@ -459,14 +827,23 @@ func (v *visitor) ignoreCall(call *ast.CallExpr) bool {
 			if !v.go111module {
 				if nonVendoredPkg, ok := nonVendoredPkgPath(pkg.Path()); ok {
 					if re, ok := v.ignore[nonVendoredPkg]; ok {
-						return re.MatchString(id.Name)
+						return ignoreLabel(nonVendoredPkg, re, id.Name)
 					}
 				}
 			}
 		}
 	}
 
-	return false
+	return ""
+}
+
+// ignoreLabel describes the ignore pattern re for pkg if it matches name,
+// and returns the empty string otherwise.
+func ignoreLabel(pkg string, re *regexp.Regexp, name string) string {
+	if !re.MatchString(name) {
+		return ""
+	}
+	return "ignore: " + pkg + ":" + re.String()
 }
 
 // nonVendoredPkgPath returns the unvendored version of the provided package path (or returns the provided path if it
@@ -533,122 +910,216 @@ func (v *visitor) isRecover(call *ast.CallExpr) bool {
 	return false
 }
 
-func (v *visitor) addErrorAtPosition(position token.Pos, call *ast.CallExpr) {
-	pos := v.pkg.Fset.Position(position)
-	lines, ok := v.lines[pos.Filename]
+func (v *visitor) addErrorAtPosition(position token.Pos, expr ast.Expr, kind ErrorKind) {
+	v.report(v.newError(position, expr, kind), "")
+}
+
+func (v *visitor) addErrorWithMessage(position token.Pos, expr ast.Expr, kind ErrorKind, message string) {
+	e := v.newError(position, expr, kind)
+	e.Message = message
+	v.report(e, "")
+}
+
+// addSuppressed records an unchecked error suppressed by the given rule.
+func (v *visitor) addSuppressed(position token.Pos, expr ast.Expr, kind ErrorKind, rule string) {
+	v.report(v.newError(position, expr, kind), rule)
+}
+
+// addCallError records an unchecked error for call, unless it is suppressed by rule.
+func (v *visitor) addCallError(position token.Pos, call *ast.CallExpr, kind ErrorKind, rule string) {
+	v.report(v.newError(position, call, kind), rule)
+}
+
+// report records e as an unchecked error, or as suppressed if rule or
+// v.suppressAll describes a rule suppressing it.
+func (v *visitor) report(e UncheckedError, rule string) {
+	if rule == "" {
+		rule = v.suppressAll
+	}
+	if rule == "" {
+		v.errors = append(v.errors, e)
+		return
+	}
+	if v.showSuppressed {
+		e.SuppressedBy = rule
+		v.suppressed = append(v.suppressed, e)
+	}
+}
+
+// newError returns an unchecked error at position in expr, which is the call
+// or type assertion leaving the error unchecked, or nil if there is none.
+func (v *visitor) newError(position token.Pos, expr ast.Expr, kind ErrorKind) UncheckedError {
+	pos := v.position(position)
+	physical := v.pkg.Fset.PositionFor(position, false)
+	lines, ok := v.lines[physical.Filename]
 	if !ok {
-		lines = readfile(pos.Filename)
-		v.lines[pos.Filename] = lines
+		if src := v.source(physical.Filename); src != nil {
+			lines = strings.Split(string(src), "\n")
+		}
+		v.lines[physical.Filename] = lines
 	}
 
 	line := "??"
-	if pos.Line-1 < len(lines) {
-		line = strings.TrimSpace(lines[pos.Line-1])
+	if physical.Line-1 < len(lines) {
+		line = strings.TrimSpace(lines[physical.Line-1])
 	}
 
-	var name string
-	if call != nil {
-		name = v.fullName(call)
+	e := UncheckedError{
+		Pos:           pos,
+		Mapped:        v.pkg.Fset.PositionFor(position, true),
+		Physical:      physical,
+		Start:         pos,
+		End:           pos,
+		Line:          line,
+		Kind:          kind,
+		Package:       v.pkg.PkgPath,
+		EnclosingFunc: v.enclosingFunc(position),
+	}
+	if expr != nil {
+		e.Start = v.position(expr.Pos())
+		e.End = v.position(expr.End())
+		e.Expr = v.exprText(expr)
+		e.ExprLine = exprLine(expr)
 	}
 
-	v.errors = append(v.errors, UncheckedError{pos, line, name})
+	switch expr := expr.(type) {
+	case *ast.CallExpr:
+		e.FuncName = v.fullName(expr)
+		if names := v.namesForExcludeCheck(expr); len(names) > 0 {
+			// The first name is that of the method as selected on the
+			// receiver's static type, which matches only this kind of call.
+			e.ExcludeName = names[0]
+		}
+		if t := v.pkg.TypesInfo.TypeOf(expr.Fun); t != nil {
+			e.Signature = t.String()
+		}
+		e.Dropped = v.droppedResults(expr)
+		e.Message = v.stickyMissing[expr]
+	case *ast.TypeAssertExpr:
+		e.Dropped = []DroppedResult{{Index: 1, Type: "bool"}}
+	}
+	return e
 }
 
-func readfile(filename string) []string {
-	var f, err = os.Open(filename)
-	if err != nil {
+// droppedResults returns the error results of call, or its only result if
+// it is a call to recover.
+func (v *visitor) droppedResults(call *ast.CallExpr) []DroppedResult {
+	t := v.pkg.TypesInfo.TypeOf(call)
+	if t == nil {
 		return nil
 	}
-
-	var lines []string
-	var scanner = bufio.NewScanner(f)
-	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
+	if v.isRecover(call) {
+		return []DroppedResult{{Index: 0, Type: t.String()}}
+	}
+	results, ok := t.(*types.Tuple)
+	if !ok {
+		results = types.NewTuple(types.NewVar(token.NoPos, nil, "", t))
 	}
-	return lines
+	var dropped []DroppedResult
+	for i, isError := range v.errorsByArg(call) {
+		if isError && i < results.Len() {
+			dropped = append(dropped, DroppedResult{Index: i, Type: results.At(i).Type().String()})
+		}
+	}
+	return dropped
 }
 
-func (v *visitor) Visit(node ast.Node) ast.Visitor {
-	switch stmt := node.(type) {
-	case *ast.ExprStmt:
-		if call, ok := stmt.X.(*ast.CallExpr); ok {
-			if !v.ignoreCall(call) && v.callReturnsError(call) {
-				v.addErrorAtPosition(call.Lparen, call)
-			}
+// enclosingFunc returns the full name of the function declared in the
+// current file that contains pos, or the empty string if there is none.
+func (v *visitor) enclosingFunc(pos token.Pos) string {
+	if v.pass == nil || v.pass.File == nil {
+		return ""
+	}
+	for _, decl := range v.pass.File.Decls {
+		fd, ok := decl.(*ast.FuncDecl)
+		if !ok || pos < fd.Pos() || pos >= fd.End() {
+			continue
 		}
-	case *ast.GoStmt:
-		if !v.ignoreCall(stmt.Call) && v.callReturnsError(stmt.Call) {
-			v.addErrorAtPosition(stmt.Call.Lparen, stmt.Call)
+		if fn, ok := v.pkg.TypesInfo.Defs[fd.Name].(*types.Func); ok {
+			return fn.FullName()
 		}
-	case *ast.DeferStmt:
-		if !v.ignoreCall(stmt.Call) && v.callReturnsError(stmt.Call) {
-			v.addErrorAtPosition(stmt.Call.Lparen, stmt.Call)
+	}
+	return ""
+}
+
+// position returns the position of p, mapped by //line directives unless
+// they are ignored.
+func (v *visitor) position(p token.Pos) token.Position {
+	return v.pkg.Fset.PositionFor(p, !v.ignoreLineDirectives)
+}
+
+// exprText returns the source text of expr, which may span several lines.
+// If the source cannot be read, expr is printed instead.
+func (v *visitor) exprText(expr ast.Expr) string {
+	// The offsets of a file are not affected by line directives.
+	if tf := v.pkg.Fset.File(expr.Pos()); tf != nil {
+		src := v.source(tf.Name())
+		start, end := tf.Offset(expr.Pos()), tf.Offset(expr.End())
+		if end <= len(src) {
+			return string(src[start:end])
 		}
-	case *ast.AssignStmt:
-		if len(stmt.Rhs) == 1 {
-			// single value on rhs; check against lhs identifiers
-			if call, ok := stmt.Rhs[0].(*ast.CallExpr); ok {
-				if !v.blank {
-					break
-				}
-				if v.ignoreCall(call) {
-					break
-				}
-				isError := v.errorsByArg(call)
-				for i := 0; i < len(stmt.Lhs); i++ {
-					if id, ok := stmt.Lhs[i].(*ast.Ident); ok {
-						// We shortcut calls to recover() because errorsByArg can't
-						// check its return types for errors since it returns interface{}.
-						if id.Name == "_" && (v.isRecover(call) || isError[i]) {
-							v.addErrorAtPosition(id.NamePos, call)
-						}
-					}
-				}
-			} else if assert, ok := stmt.Rhs[0].(*ast.TypeAssertExpr); ok {
-				if !v.asserts {
-					break
-				}
-				if assert.Type == nil {
-					// type switch
-					break
-				}
-				if len(stmt.Lhs) < 2 {
-					// assertion result not read
-					v.addErrorAtPosition(stmt.Rhs[0].Pos(), nil)
-				} else if id, ok := stmt.Lhs[1].(*ast.Ident); ok && v.blank && id.Name == "_" {
-					// assertion result ignored
-					v.addErrorAtPosition(id.NamePos, nil)
-				}
-			}
-		} else {
-			// multiple value on rhs; in this case a call can't return
-			// multiple values. Assume len(stmt.Lhs) == len(stmt.Rhs)
-			for i := 0; i < len(stmt.Lhs); i++ {
-				if id, ok := stmt.Lhs[i].(*ast.Ident); ok {
-					if call, ok := stmt.Rhs[i].(*ast.CallExpr); ok {
-						if !v.blank {
-							continue
-						}
-						if v.ignoreCall(call) {
-							continue
-						}
-						if id.Name == "_" && v.callReturnsError(call) {
-							v.addErrorAtPosition(id.NamePos, call)
-						}
-					} else if assert, ok := stmt.Rhs[i].(*ast.TypeAssertExpr); ok {
-						if !v.asserts {
-							continue
-						}
-						if assert.Type == nil {
-							// Shouldn't happen anyway, no multi assignment in type switches
-							continue
-						}
-						v.addErrorAtPosition(id.NamePos, nil)
-					}
-				}
-			}
+	}
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, v.pkg.Fset, expr); err != nil {
+		return types.ExprString(expr)
+	}
+	return buf.String()
+}
+
+// exprLine prints expr on one line, without the comments and line breaks of
+// its source. Function literals, whose bodies the printer breaks into lines,
+// are abbreviated as by types.ExprString.
+func exprLine(expr ast.Expr) string {
+	hasFuncLit := false
+	ast.Inspect(expr, func(node ast.Node) bool {
+		if _, ok := node.(*ast.FuncLit); ok {
+			hasFuncLit = true
 		}
-	default:
+		return !hasFuncLit
+	})
+	var buf bytes.Buffer
+	// Without the positions of its file, the expression is printed on one line.
+	if hasFuncLit || printer.Fprint(&buf, token.NewFileSet(), expr) != nil {
+		return types.ExprString(expr)
+	}
+	return buf.String()
+}
+
+// source returns the contents of the named file, or nil if it cannot be read.
+func (v *visitor) source(filename string) []byte {
+	src, ok := v.sources[filename]
+	if !ok {
+		src = readfile(filename, v.overlay)
+		v.sources[filename] = src
+	}
+	return src
+}
+
+// readfile returns the contents of the named file, preferring its contents
+// in overlay over the file on disk, or nil if it cannot be read.
+func readfile(filename string, overlay map[string][]byte) []byte {
+	if src, ok := overlay[filename]; ok {
+		return src
+	}
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil
+	}
+	return src
+}
+
+func (v *visitor) Visit(node ast.Node) ast.Visitor {
+	if node == nil {
+		return v
+	}
+	if call, ok := node.(*ast.CallExpr); ok {
+		v.calls++
+		if v.callReturnsError(call) {
+			v.errorCalls++
+		}
+	}
+	for _, check := range v.checks {
+		check.Check(v.pass, node)
 	}
 	return v
 }
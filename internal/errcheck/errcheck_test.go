@@ -1,12 +1,19 @@
 package errcheck
 
 import (
+	"bytes"
 	"fmt"
+	"go/ast"
+	"go/types"
 	"io/ioutil"
 	"os"
 	"path"
+	"reflect"
 	"regexp"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"golang.org/x/tools/go/packages"
 )
@@ -17,6 +24,8 @@ var (
 	uncheckedMarkers map[marker]bool
 	blankMarkers     map[marker]bool
 	assertMarkers    map[marker]bool
+	iteratorMarkers  map[marker]bool
+	excludedMarkers  map[marker]bool
 )
 
 type marker struct {
@@ -36,6 +45,8 @@ func init() {
 	uncheckedMarkers = make(map[marker]bool)
 	blankMarkers = make(map[marker]bool)
 	assertMarkers = make(map[marker]bool)
+	iteratorMarkers = make(map[marker]bool)
+	excludedMarkers = make(map[marker]bool)
 
 	cfg := &packages.Config{
 		Mode:  packages.LoadSyntax,
@@ -58,6 +69,10 @@ func init() {
 					blankMarkers[m] = true
 				case "ASSERT\n":
 					assertMarkers[m] = true
+				case "ITERATOR\n":
+					iteratorMarkers[m] = true
+				case "EXCLUDED\n":
+					excludedMarkers[m] = true
 				}
 			}
 		}
@@ -69,6 +84,7 @@ type flags uint
 const (
 	CheckAsserts flags = 1 << iota
 	CheckBlank
+	CheckIterators
 )
 
 // TestUnchecked runs a test against the example files and ensures all unchecked errors are caught.
@@ -86,6 +102,70 @@ func TestAll(t *testing.T) {
 	test(t, CheckAsserts|CheckBlank)
 }
 
+// TestIterators ensures that iterators whose deferred errors are never consulted are caught.
+func TestIterators(t *testing.T) {
+	test(t, CheckIterators)
+}
+
+// TestShowSuppressed ensures that excluded calls are collected along with the rule excluding them.
+func TestShowSuppressed(t *testing.T) {
+	checker := NewChecker()
+	checker.ShowSuppressed = true
+	checker.SetExclude(map[string]bool{
+		fmt.Sprintf("(%s.ErrorMakerInterface).MakeNilError", testPackage): true,
+	})
+	err := checker.CheckPackages(testPackage)
+	uerr, ok := err.(*UncheckedErrors)
+	if !ok {
+		t.Fatalf("wrong error type returned: %v", err)
+	}
+
+	if len(uerr.Errors) != len(uncheckedMarkers) {
+		t.Errorf("got %d errors, want %d", len(uerr.Errors), len(uncheckedMarkers))
+	}
+excluded_loop:
+	for k := range excludedMarkers {
+		for _, e := range uerr.Suppressed {
+			if newMarker(e) == k {
+				continue excluded_loop
+			}
+		}
+		t.Errorf("Expected suppressed at %s", k)
+	}
+	for i, e := range uerr.Suppressed {
+		if uncheckedMarkers[newMarker(e)] {
+			t.Errorf("%d: unchecked error suppressed: %v", i, e)
+		}
+		if !strings.HasPrefix(e.SuppressedBy, "default-exclude: ") && !strings.HasPrefix(e.SuppressedBy, "exclude: ") {
+			t.Errorf("%d: got rule %q, want an exclude", i, e.SuppressedBy)
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	checker := NewChecker()
+	explanations, err := checker.Explain("../../testdata/main3.go", 16, 0)
+	if err != nil {
+		t.Fatalf("Explain failed: %v", err)
+	}
+	if len(explanations) != 1 {
+		t.Fatalf("got %d explanations, want 1", len(explanations))
+	}
+	e := explanations[0]
+	if e.FuncName != "fmt.Fprintln" {
+		t.Errorf("FuncName got %q want %q", e.FuncName, "fmt.Fprintln")
+	}
+	if !e.ReturnsError {
+		t.Errorf("ReturnsError got false want true")
+	}
+	if want := "default-exclude: fmt.Fprintln(os.Stderr)"; e.SuppressedBy != want {
+		t.Errorf("SuppressedBy got %q want %q", e.SuppressedBy, want)
+	}
+	if len(e.FirstArg) == 0 || e.FirstArg[0] != "os.Stderr" {
+		t.Errorf("FirstArg got %q want os.Stderr first", e.FirstArg)
+	}
+}
+
 func TestBuildTags(t *testing.T) {
 	const (
 		// uses "custom1" build tag and contains 1 unchecked error
@@ -271,34 +351,38 @@ require github.com/testlog v0.0.0
 		},
 	}
 
-	for i, currCase := range cases {
-		checker := NewChecker()
-		checker.Ignore = currCase.ignore
-		loadPackages = func(cfg *packages.Config, paths ...string) ([]*packages.Package, error) {
-			cfg.Env = append(os.Environ(),
-				"GOPATH="+tmpGopath,
-				"GOFLAGS=-mod=vendor")
-			cfg.Dir = testVendorDir
-			pkgs, err := packages.Load(cfg, paths...)
-			return pkgs, err
-		}
-		err := checker.CheckPackages("github.com/testvendor")
+	// The package is checked both as a module, where the vendored package
+	// has its unvendored path, and in GOPATH mode, where it does not.
+	for _, mode := range []string{"GOFLAGS=-mod=vendor", "GO111MODULE=off"} {
+		for i, currCase := range cases {
+			checker := NewChecker()
+			checker.Ignore = currCase.ignore
+			loadPackages = func(cfg *packages.Config, paths ...string) ([]*packages.Package, error) {
+				cfg.Env = append(os.Environ(),
+					"GOPATH="+tmpGopath,
+					mode)
+				cfg.Dir = testVendorDir
+				pkgs, err := packages.Load(cfg, paths...)
+				return pkgs, err
+			}
+			err := checker.CheckPackages("github.com/testvendor")
 
-		if currCase.numExpectedErrs == 0 {
-			if err != nil {
-				t.Errorf("Case %d: expected no errors, but got: %v", i, err)
+			if currCase.numExpectedErrs == 0 {
+				if err != nil {
+					t.Errorf("%s case %d: expected no errors, but got: %v", mode, i, err)
+				}
+				continue
 			}
-			continue
-		}
 
-		uerr, ok := err.(*UncheckedErrors)
-		if !ok {
-			t.Errorf("Case %d: wrong error type returned: %v", i, err)
-			continue
-		}
+			uerr, ok := err.(*UncheckedErrors)
+			if !ok {
+				t.Errorf("%s case %d: wrong error type returned: %v", mode, i, err)
+				continue
+			}
 
-		if currCase.numExpectedErrs != len(uerr.Errors) {
-			t.Errorf("Case %d:\nExpected: %d errors\nActual:   %d errors", i, currCase.numExpectedErrs, len(uerr.Errors))
+			if currCase.numExpectedErrs != len(uerr.Errors) {
+				t.Errorf("%s case %d:\nExpected: %d errors\nActual:   %d errors", mode, i, currCase.numExpectedErrs, len(uerr.Errors))
+			}
 		}
 	}
 }
@@ -399,14 +483,871 @@ require github.com/testlog v0.0.0
 	}
 }
 
+func TestOverlay(t *testing.T) {
+	const testOverlayGoMod = `module github.com/testoverlay`
+	const testOverlayDisk = `package main
+
+func main() {
+}
+`
+	const testOverlayBuffer = `package main
+
+import "os"
+
+func main() {
+	os.Remove("file") // unchecked in the overlay only
+}
+`
+
+	tmpDir := writeTestModule(t, map[string]string{
+		"go.mod":  testOverlayGoMod,
+		"main.go": testOverlayDisk,
+	})
+	mainFile := path.Join(tmpDir, "main.go")
+
+	checker := NewChecker()
+	checker.Overlay = map[string][]byte{mainFile: []byte(testOverlayBuffer)}
+	err := checker.CheckPackages("github.com/testoverlay")
+
+	uerr, ok := err.(*UncheckedErrors)
+	if !ok {
+		t.Fatalf("wrong error type returned: %v", err)
+	}
+	if len(uerr.Errors) != 1 {
+		t.Fatalf("Expected: 1 error\nActual:   %d errors", len(uerr.Errors))
+	}
+	if want := `os.Remove("file") // unchecked in the overlay only`; uerr.Errors[0].Line != want {
+		t.Errorf("Line got %q want %q", uerr.Errors[0].Line, want)
+	}
+}
+
+func TestDeferClose(t *testing.T) {
+	const testDeferCloseGoMod = `module github.com/testdeferclose`
+	const testDeferCloseMain = `package main
+
+import "os"
+
+func read() {
+	f, err := os.Open("in")
+	if err != nil {
+		return
+	}
+	defer f.Close()
+}
+
+func readFlags() {
+	f, err := os.OpenFile("in", os.O_RDONLY, 0)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+}
+
+func write() {
+	f, err := os.Create("out")
+	if err != nil {
+		return
+	}
+	defer f.Close()
+}
+
+func appendTo() {
+	f, err := os.OpenFile("out", os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+}
+
+func unknown(f *os.File) {
+	defer f.Close()
+}
+
+func main() {
+}
+`
+
+	tmpDir := writeTestModule(t, map[string]string{
+		"go.mod":  testDeferCloseGoMod,
+		"main.go": testDeferCloseMain,
+	})
+
+	cases := []struct {
+		deferClose bool
+		lines      []int
+		messages   int
+	}{
+		// all deferred closes are reported
+		{
+			deferClose: false,
+			lines:      []int{10, 18, 26, 34, 38},
+			messages:   0,
+		},
+		// read-only closes are ignored, writable ones explained
+		{
+			deferClose: true,
+			lines:      []int{26, 34, 38},
+			messages:   2,
+		},
+	}
+
+	for i, currCase := range cases {
+		checker := NewChecker()
+		checker.DeferClose = currCase.deferClose
+		err := checker.CheckPackages("github.com/testdeferclose")
+
+		uerr, ok := err.(*UncheckedErrors)
+		if !ok {
+			t.Errorf("Case %d: wrong error type returned: %v", i, err)
+			continue
+		}
+		if len(uerr.Errors) != len(currCase.lines) {
+			t.Errorf("Case %d:\nExpected: %d errors\nActual:   %d errors", i, len(currCase.lines), len(uerr.Errors))
+			continue
+		}
+		messages := 0
+		for j, e := range uerr.Errors {
+			if e.Pos.Line != currCase.lines[j] {
+				t.Errorf("Case %d: error %d at line %d, want %d", i, j, e.Pos.Line, currCase.lines[j])
+			}
+			if e.Message != "" {
+				messages++
+			}
+		}
+		if messages != currCase.messages {
+			t.Errorf("Case %d: got %d messages, want %d", i, messages, currCase.messages)
+		}
+	}
+
+	// Explain reports the rule suppressing the read-only close.
+	checker := NewChecker()
+	checker.DeferClose = true
+	explanations, err := checker.Explain(path.Join(tmpDir, "main.go"), 10, 0)
+	if err != nil {
+		t.Fatalf("Explain failed: %v", err)
+	}
+	if len(explanations) != 1 || explanations[0].SuppressedBy != "deferclose: read-only file" {
+		t.Errorf("got explanations %+v, want one suppressed by deferclose", explanations)
+	}
+}
+
+func TestExcludeArgs(t *testing.T) {
+	const testExcludeArgsGoMod = `module github.com/testexcludeargs`
+	const testExcludeArgsMain = `package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+var Sink = &bytes.Buffer{}
+
+func handler(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	io.Copy(&buf, r.Body)
+	io.Copy(os.Stdout, strings.NewReader(""))
+	io.Copy(os.Stdout, r.Body)
+	fmt.Fprintf(w, "hello")
+	fmt.Fprintf(os.Stdout, "hello")
+	io.WriteString(Sink, "hello")
+	io.WriteString(os.Stdout, "hello")
+}
+
+func main() {
+}
+`
+
+	writeTestModule(t, map[string]string{
+		"go.mod":  testExcludeArgsGoMod,
+		"main.go": testExcludeArgsMain,
+	})
+
+	checker := NewChecker()
+	checker.SetExclude(map[string]bool{
+		"io.Copy(*bytes.Buffer)":                          true,
+		"io.Copy(1:*strings.Reader)":                      true,
+		"fmt.Fprintf(implements net/http.ResponseWriter)": true,
+		"io.WriteString(github.com/testexcludeargs.Sink)": true,
+	})
+	err := checker.CheckPackages("github.com/testexcludeargs")
+
+	uerr, ok := err.(*UncheckedErrors)
+	if !ok {
+		t.Fatalf("wrong error type returned: %v", err)
+	}
+	want := []int{18, 20, 22}
+	if len(uerr.Errors) != len(want) {
+		t.Fatalf("Expected: %d errors\nActual:   %d errors: %v", len(want), len(uerr.Errors), uerr.Errors)
+	}
+	for i, e := range uerr.Errors {
+		if e.Pos.Line != want[i] {
+			t.Errorf("error %d at line %d, want %d", i, e.Pos.Line, want[i])
+		}
+	}
+}
+
+func TestExcludeReceiver(t *testing.T) {
+	const testExcludeReceiverGoMod = `module github.com/testexcludereceiver`
+	const testExcludeReceiverMain = `package main
+
+import "os"
+
+func main() {
+	os.Stdout.Write(nil)
+	os.Stderr.Sync()
+	os.Stdout.Sync()
+	f := os.Stdout
+	f.Write(nil)
+}
+`
+
+	writeTestModule(t, map[string]string{
+		"go.mod":  testExcludeReceiverGoMod,
+		"main.go": testExcludeReceiverMain,
+	})
+
+	checker := NewChecker()
+	checker.SetExclude(map[string]bool{
+		"(*os.File).Write[os.Stdout]": true,
+		"(*os.File).Sync[os.Stderr]":  true,
+	})
+	err := checker.CheckPackages("github.com/testexcludereceiver")
+
+	uerr, ok := err.(*UncheckedErrors)
+	if !ok {
+		t.Fatalf("wrong error type returned: %v", err)
+	}
+	want := []int{8, 10}
+	if len(uerr.Errors) != len(want) {
+		t.Fatalf("Expected: %d errors\nActual:   %d errors: %v", len(want), len(uerr.Errors), uerr.Errors)
+	}
+	for i, e := range uerr.Errors {
+		if e.Pos.Line != want[i] {
+			t.Errorf("error %d at line %d, want %d", i, e.Pos.Line, want[i])
+		}
+	}
+}
+
+// houseRule reports calls to os.Remove whose error is discarded even if they are excluded.
+type houseRule struct{}
+
+func (houseRule) Check(pass *Pass, node ast.Node) {
+	stmt, ok := node.(*ast.ExprStmt)
+	if !ok {
+		return
+	}
+	call, ok := stmt.X.(*ast.CallExpr)
+	if !ok || pass.FuncName(call) != "os.Remove" || pass.SuppressedBy(call) == "" {
+		return
+	}
+	pass.Report(call.Lparen, call, UncheckedCall, "os.Remove must be checked")
+}
+
+func TestChecks(t *testing.T) {
+	const testChecksGoMod = `module github.com/testchecks`
+	const testChecksMain = `package main
+
+import "os"
+
+func main() {
+	os.Remove("a")
+	os.Chdir("b")
+}
+`
+
+	writeTestModule(t, map[string]string{
+		"go.mod":  testChecksGoMod,
+		"main.go": testChecksMain,
+	})
+
+	checker := NewChecker()
+	checker.SetExclude(map[string]bool{"os.Remove": true, "os.Chdir": true})
+	checker.Checks = []Check{houseRule{}}
+	err := checker.CheckPackages("github.com/testchecks")
+
+	uerr, ok := err.(*UncheckedErrors)
+	if !ok {
+		t.Fatalf("wrong error type returned: %v", err)
+	}
+	if len(uerr.Errors) != 1 {
+		t.Fatalf("Expected: 1 error\nActual:   %d errors: %v", len(uerr.Errors), uerr.Errors)
+	}
+	if e := uerr.Errors[0]; e.Pos.Line != 6 || e.Message != "os.Remove must be checked" {
+		t.Errorf("got error %v, want the house rule at line 6", e)
+	}
+}
+
+func TestExcludeFuncs(t *testing.T) {
+	const testExcludeFuncsGoMod = `module github.com/testexcludefuncs`
+	const testExcludeFuncsMain = `package main
+
+import "errors"
+
+func mayFail() error    { return errors.New("failed") }
+func neverFails() error { return nil }
+
+func main() {
+	mayFail()
+	neverFails()
+}
+`
+
+	writeTestModule(t, map[string]string{
+		"go.mod":  testExcludeFuncsGoMod,
+		"main.go": testExcludeFuncsMain,
+	})
+
+	var log bytes.Buffer
+	checker := NewChecker()
+	checker.ShowSuppressed = true
+	checker.Logger = NewLogger(&log, LogTrace)
+	checker.AddExcludeFunc("never-fails", func(fn *types.Func, call *ast.CallExpr, names []string, pkg *packages.Package) bool {
+		if pkg.PkgPath != "github.com/testexcludefuncs" {
+			t.Errorf("got package %q", pkg.PkgPath)
+		}
+		if len(names) != 1 || names[0] != fn.FullName() {
+			t.Errorf("got names %q for %s", names, fn.FullName())
+		}
+		return fn.Name() == "neverFails"
+	})
+	err := checker.CheckPackages("github.com/testexcludefuncs")
+
+	uerr, ok := err.(*UncheckedErrors)
+	if !ok {
+		t.Fatalf("wrong error type returned: %v", err)
+	}
+	if len(uerr.Errors) != 1 || uerr.Errors[0].Pos.Line != 9 {
+		t.Errorf("got errors %v, want one at line 9", uerr.Errors)
+	}
+	if len(uerr.Suppressed) != 1 || uerr.Suppressed[0].SuppressedBy != "exclude-func: never-fails" {
+		t.Errorf("got suppressed %v, want one suppressed by exclude-func: never-fails", uerr.Suppressed)
+	}
+	for _, want := range []string{
+		"debug: loaded 1 packages\n",
+		"main.go:10:12: neverFails is suppressed by exclude-func: never-fails\n",
+		"main.go:9:9: mayFail is checked",
+	} {
+		if !strings.Contains(log.String(), want) {
+			t.Errorf("log does not contain %q:\n%s", want, log.String())
+		}
+	}
+
+	// Suppressed errors alone are not a failure, but Run still returns them.
+	checker.SetExclude(map[string]bool{"github.com/testexcludefuncs.mayFail": true})
+	if err := checker.CheckPackages("github.com/testexcludefuncs"); err != nil {
+		t.Errorf("CheckPackages with only suppressed errors got %v, want nil", err)
+	}
+	r, err := checker.Run("github.com/testexcludefuncs")
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(r.Errors) != 0 || len(r.Suppressed) != 2 {
+		t.Errorf("got errors %v and suppressed %v, want none and two", r.Errors, r.Suppressed)
+	}
+}
+
+// TestExcludeNames ensures that the exclude names of the errors reported by
+// the iterator, sticky writer and deferred close checks exclude them.
+func TestExcludeNames(t *testing.T) {
+	const testExcludeNamesGoMod = `module github.com/testexcludenames`
+	const testExcludeNamesMain = `package main
+
+import (
+	"bufio"
+	"os"
+)
+
+func main() {
+	s := bufio.NewScanner(os.Stdin)
+	for s.Scan() {
+	}
+	w := bufio.NewWriter(os.Stdout)
+	w.WriteString("unflushed")
+	f, _ := os.Create("out")
+	defer f.Close()
+}
+`
+
+	writeTestModule(t, map[string]string{
+		"go.mod":  testExcludeNamesGoMod,
+		"main.go": testExcludeNamesMain,
+	})
+
+	checker := NewChecker()
+	checker.Iterators = true
+	checker.DeferClose = true
+	r, err := checker.Run("github.com/testexcludenames")
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	exclude := make(map[string]bool)
+	for _, e := range r.Errors {
+		exclude[e.ExcludeName] = true
+	}
+	want := map[string]bool{
+		"(*bufio.Scanner).Scan":       true,
+		"(*bufio.Writer).WriteString": true,
+		"(*os.File).Close":            true,
+	}
+	if len(r.Errors) != len(want) || !reflect.DeepEqual(exclude, want) {
+		t.Fatalf("got errors %v with exclude names %v, want %v", r.Errors, exclude, want)
+	}
+
+	checker.SetExclude(exclude)
+	r, err = checker.Run("github.com/testexcludenames")
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(r.Errors) != 0 {
+		t.Errorf("got errors %v with their exclude names %v excluded, want none", r.Errors, exclude)
+	}
+}
+
+func TestErrorDetails(t *testing.T) {
+	const testErrorDetailsGoMod = `module github.com/testerrordetails`
+	const testErrorDetailsMain = `package main
+
+import "os"
+
+func run(f *os.File) {
+	go f.Close()
+	defer f.Sync()
+	_, _ = f.Write( // nothing
+		nil,
+	)
+	_, _ = f.Close(), recover()
+}
+
+var i interface{} = 1
+
+func main() {
+	_ = i.(int)
+}
+`
+
+	writeTestModule(t, map[string]string{
+		"go.mod":  testErrorDetailsGoMod,
+		"main.go": testErrorDetailsMain,
+	})
+
+	checker := NewChecker()
+	checker.Blank = true
+	checker.Asserts = true
+	err := checker.CheckPackages("github.com/testerrordetails")
+
+	uerr, ok := err.(*UncheckedErrors)
+	if !ok {
+		t.Fatalf("wrong error type returned: %v", err)
+	}
+
+	const pkg = "github.com/testerrordetails"
+	type details struct {
+		line, endLine     int
+		kind              ErrorKind
+		enclosing         string
+		signature         string
+		dropped           []DroppedResult
+		goStmt, deferStmt bool
+	}
+	want := []details{
+		{6, 6, UncheckedCall, pkg + ".run", "func() error", []DroppedResult{{0, "error"}}, true, false},
+		{7, 7, UncheckedCall, pkg + ".run", "func() error", []DroppedResult{{0, "error"}}, false, true},
+		{8, 10, BlankAssignment, pkg + ".run", "func(b []byte) (n int, err error)", []DroppedResult{{1, "error"}}, false, false},
+		{11, 11, BlankAssignment, pkg + ".run", "func() error", []DroppedResult{{0, "error"}}, false, false},
+		{11, 11, BlankAssignment, pkg + ".run", "func() interface{}", []DroppedResult{{0, "interface{}"}}, false, false},
+		{17, 17, UncheckedAssertion, pkg + ".main", "", []DroppedResult{{1, "bool"}}, false, false},
+	}
+	if len(uerr.Errors) != len(want) {
+		t.Fatalf("Expected: %d errors\nActual:   %d errors: %v", len(want), len(uerr.Errors), uerr.Errors)
+	}
+	for i, e := range uerr.Errors {
+		got := details{e.Pos.Line, e.End.Line, e.Kind, e.EnclosingFunc, e.Signature, e.Dropped, e.Go, e.Defer}
+		if !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("error %d: got %+v want %+v", i, got, want[i])
+		}
+		if e.Package != pkg {
+			t.Errorf("error %d: got package %q want %q", i, e.Package, pkg)
+		}
+	}
+
+	if e := uerr.Errors[2]; e.Start.Line != 8 || e.Start.Column != 9 || e.Expr != "f.Write( // nothing\n\t\tnil,\n\t)" {
+		t.Errorf("got expression %q at %v, want the whole call to Write at 8:9", e.Expr, e.Start)
+	}
+	if e := uerr.Errors[2]; e.ExprLine != "f.Write(nil)" {
+		t.Errorf("got expression line %q, want the call to Write without comments", e.ExprLine)
+	}
+	if e := uerr.Errors[5]; e.Expr != "i.(int)" {
+		t.Errorf("got expression %q, want the assertion", e.Expr)
+	}
+}
+
+func TestRun(t *testing.T) {
+	const testRunGoMod = `module github.com/testrun`
+	const testRunMain = `package main
+
+import "os"
+
+func main() {
+	os.Remove("a")
+	_ = os.Remove("b")
+	os.Getpid()
+}
+`
+	const testRunGenerated = `// Code generated by hand. DO NOT EDIT.
+
+package main
+
+import "os"
+
+func generated() {
+	os.Remove("c")
+}
+`
+	const testRunBroken = `package broken
+
+func f() { undefined() }
+`
+
+	writeTestModule(t, map[string]string{
+		"go.mod":           testRunGoMod,
+		"main.go":          testRunMain,
+		"generated.go":     testRunGenerated,
+		"broken/broken.go": testRunBroken,
+	})
+
+	checker := NewChecker()
+	checker.Blank = true
+	checker.WithoutGeneratedCode = true
+
+	r, err := checker.Run("./...")
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(r.Diagnostics) != 1 || r.Diagnostics[0].Package != "github.com/testrun/broken" {
+		t.Errorf("got diagnostics %v, want errors in github.com/testrun/broken", r.Diagnostics)
+	}
+	if len(r.Errors) != 2 {
+		t.Errorf("got %d errors, want 2: %v", len(r.Errors), r.Errors)
+	}
+	s := r.Stats
+	if s.Packages != 1 || s.Files != 1 || s.GeneratedFiles != 1 || s.Calls != 3 || s.ErrorCalls != 2 {
+		t.Errorf("got stats %+v", s)
+	}
+	if s.Kinds[UncheckedCall] != 1 || s.Kinds[BlankAssignment] != 1 {
+		t.Errorf("got kinds %v, want 1 call and 1 blank assignment", s.Kinds)
+	}
+
+	// Listing the calls of generated files does not count them.
+	checker.ShowSuppressed = true
+	r, err = checker.Run("./...")
+	checker.ShowSuppressed = false
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if s := r.Stats; s.Calls != 3 || s.ErrorCalls != 2 || len(r.Suppressed) == 0 {
+		t.Errorf("with ShowSuppressed got stats %+v and suppressed %v", s, r.Suppressed)
+	}
+
+	err = checker.CheckPackages("./...")
+	if _, ok := err.(PackageError); !ok {
+		t.Errorf("CheckPackages returned %v, want a PackageError", err)
+	}
+
+	// Runs may be concurrent with each other and with changes to the excludes.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			r, err := checker.Run(".")
+			if err != nil {
+				t.Errorf("Run failed: %v", err)
+				return
+			}
+			if len(r.Errors) != 0 && len(r.Errors) != 2 {
+				t.Errorf("got %d errors, want 0 or 2", len(r.Errors))
+			}
+		}()
+		go func(i int) {
+			defer wg.Done()
+			exclude := map[string]bool{}
+			if i%2 == 0 {
+				exclude["os.Remove"] = true
+			}
+			checker.SetExclude(exclude)
+		}(i)
+	}
+	wg.Wait()
+
+	// The exclude rules may be changed while packages are loaded.
+	load := loadPackages
+	loading, release := make(chan bool), make(chan bool)
+	loadPackages = func(cfg *packages.Config, paths ...string) ([]*packages.Package, error) {
+		loading <- true
+		<-release
+		return load(cfg, paths...)
+	}
+	go func() {
+		if _, err := checker.Run("."); err != nil {
+			t.Errorf("Run failed: %v", err)
+		}
+		release <- true
+	}()
+	<-loading
+	changed := make(chan bool)
+	go func() {
+		checker.SetExclude(nil)
+		changed <- true
+	}()
+	select {
+	case <-changed:
+	case <-time.After(time.Minute):
+		t.Fatal("SetExclude waited for the packages to load")
+	}
+	release <- true
+	<-release
+}
+
+func TestLineDirectives(t *testing.T) {
+	const testLineDirectivesGoMod = `module github.com/testlinedirectives`
+	const testLineDirectivesMain = `package main
+
+import "os"
+
+func main() {
+//line parser.y:40
+	os.Remove("a")
+}
+`
+	const testLineDirectivesGen = `//line grammar.y:50
+package main
+
+import "os"
+
+func gen() {
+	os.Getpid()
+}
+`
+
+	tmpDir := writeTestModule(t, map[string]string{
+		"go.mod":  testLineDirectivesGoMod,
+		"main.go": testLineDirectivesMain,
+		"gen.go":  testLineDirectivesGen,
+	})
+
+	for _, ignoreLineDirectives := range []bool{false, true} {
+		checker := NewChecker()
+		checker.IgnoreLineDirectives = ignoreLineDirectives
+		err := checker.CheckPackages("github.com/testlinedirectives")
+		uerr, ok := err.(*UncheckedErrors)
+		if !ok {
+			t.Fatalf("wrong error type returned: %v", err)
+		}
+		if len(uerr.Errors) != 1 {
+			t.Fatalf("Expected: 1 error\nActual:   %d errors: %v", len(uerr.Errors), uerr.Errors)
+		}
+		e := uerr.Errors[0]
+		if path.Base(e.Mapped.Filename) != "parser.y" || e.Mapped.Line != 40 {
+			t.Errorf("got mapped position %v, want parser.y:40", e.Mapped)
+		}
+		if path.Base(e.Physical.Filename) != "main.go" || e.Physical.Line != 7 {
+			t.Errorf("got physical position %v, want main.go:7", e.Physical)
+		}
+		want := e.Mapped
+		if ignoreLineDirectives {
+			want = e.Physical
+		}
+		if e.Pos != want {
+			t.Errorf("got position %v, want %v", e.Pos, want)
+		}
+		if e.Line != `os.Remove("a")` {
+			t.Errorf("got line %q", e.Line)
+		}
+	}
+
+	// Explain finds calls by their physical positions.
+	explanations, err := NewChecker().Explain(path.Join(tmpDir, "gen.go"), 7, 0)
+	if err != nil {
+		t.Fatalf("Explain failed: %v", err)
+	}
+	if len(explanations) != 1 {
+		t.Fatalf("got %d explanations, want 1", len(explanations))
+	}
+	e := explanations[0]
+	if path.Base(e.Pos.Filename) != "grammar.y" || e.Pos.Line != 55 {
+		t.Errorf("got position %v, want grammar.y:55", e.Pos)
+	}
+	if path.Base(e.Physical.Filename) != "gen.go" || e.Physical.Line != 7 {
+		t.Errorf("got physical position %v, want gen.go:7", e.Physical)
+	}
+}
+
+func TestRunModules(t *testing.T) {
+	const testRunModulesWork = `go 1.18
+
+use (
+	./a
+	./b
+)
+`
+	const testRunModulesA = `package a
+
+import "os"
+
+func F() error {
+	os.Remove("a")
+	return nil
+}
+`
+	const testRunModulesB = `package b
+
+import (
+	"os"
+
+	"example.com/a"
+)
+
+func g() {
+	a.F()
+	os.Remove("b")
+}
+`
+
+	tmpDir := writeTestModule(t, map[string]string{
+		"go.work":  testRunModulesWork,
+		"a/go.mod": "module example.com/a\n",
+		"a/a.go":   testRunModulesA,
+		"b/go.mod": "module example.com/b\n",
+		"b/b.go":   testRunModulesB,
+	})
+
+	loadPackages = func(cfg *packages.Config, paths ...string) ([]*packages.Package, error) {
+		// -mod=mod is not allowed in workspace mode.
+		cfg.Env = append(os.Environ(), "GOFLAGS=")
+		return packages.Load(cfg, paths...)
+	}
+
+	dirs, err := FindModules(tmpDir)
+	if err != nil {
+		t.Fatalf("FindModules failed: %v", err)
+	}
+	checker := NewChecker()
+	// Exclude names do not depend on the module the call is checked in.
+	checker.SetExclude(map[string]bool{"example.com/a.F": true})
+	r, err := checker.RunModules(dirs, "./...")
+	if err != nil {
+		t.Fatalf("RunModules failed: %v", err)
+	}
+
+	var got []string
+	for _, e := range r.Errors {
+		got = append(got, e.Package+" "+e.FuncName)
+	}
+	want := []string{"example.com/a os.Remove", "example.com/b os.Remove"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got errors %v, want %v", got, want)
+	}
+	if r.Stats.Packages != 2 || r.Stats.Files != 2 || r.Stats.Kinds[UncheckedCall] != 2 {
+		t.Errorf("got stats %+v, want 2 packages, 2 files and 2 unchecked calls", r.Stats)
+	}
+	if want := []string{"example.com/a", "example.com/b"}; !reflect.DeepEqual(r.Packages, want) {
+		t.Errorf("got packages %v, want %v", r.Packages, want)
+	}
+}
+
+func TestConfigs(t *testing.T) {
+	const testConfigsGoMod = `module github.com/testconfigs`
+	const testConfigsMain = `package main
+
+import "os"
+
+func main() {
+	os.Remove("all")
+	platform()
+}
+`
+	const testConfigsLinux = `package main
+
+import "os"
+
+func platform() {
+	os.Remove("linux")
+}
+`
+	const testConfigsWindows = `package main
+
+import "os"
+
+func platform() {
+	os.Remove("windows")
+}
+`
+	const testConfigsIntegration = `//go:build integration
+
+package main
+
+import "os"
+
+func integration() {
+	os.Remove("integration")
+}
+`
+
+	writeTestModule(t, map[string]string{
+		"go.mod":          testConfigsGoMod,
+		"main.go":         testConfigsMain,
+		"main_linux.go":   testConfigsLinux,
+		"main_windows.go": testConfigsWindows,
+		"integration.go":  testConfigsIntegration,
+	})
+
+	checker := NewChecker()
+	checker.Configs = []BuildConfig{
+		{GOOS: "linux", GOARCH: "amd64"},
+		{GOOS: "windows", GOARCH: "amd64"},
+		{GOOS: "linux", GOARCH: "amd64", Tags: []string{"integration"}},
+	}
+	r, err := checker.Run("./...")
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	got := make(map[string][]string)
+	for _, e := range r.Errors {
+		got[e.Line] = e.Configs
+	}
+	want := map[string][]string{
+		`os.Remove("all")`:         {"linux/amd64", "linux/amd64 [integration]", "windows/amd64"},
+		`os.Remove("linux")`:       {"linux/amd64", "linux/amd64 [integration]"},
+		`os.Remove("windows")`:     {"windows/amd64"},
+		`os.Remove("integration")`: {"linux/amd64 [integration]"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got configurations %v, want %v", got, want)
+	}
+	if r.Stats.Packages != 3 || r.Stats.Kinds[UncheckedCall] != 4 {
+		t.Errorf("got stats %+v, want 3 packages and 4 unchecked calls", r.Stats)
+	}
+	// The package is listed once, whatever the configurations it is checked in.
+	if len(r.Packages) != 1 {
+		t.Errorf("got packages %v, want one", r.Packages)
+	}
+}
+
 func test(t *testing.T, f flags) {
 	var (
-		asserts bool = f&CheckAsserts != 0
-		blank   bool = f&CheckBlank != 0
+		asserts   bool = f&CheckAsserts != 0
+		blank     bool = f&CheckBlank != 0
+		iterators bool = f&CheckIterators != 0
 	)
 	checker := NewChecker()
 	checker.Asserts = asserts
 	checker.Blank = blank
+	checker.Iterators = iterators
 	checker.SetExclude(map[string]bool{
 		fmt.Sprintf("(%s.ErrorMakerInterface).MakeNilError", testPackage): true,
 	})
@@ -423,6 +1364,9 @@ func test(t *testing.T, f flags) {
 	if asserts {
 		numErrors += len(assertMarkers)
 	}
+	if iterators {
+		numErrors += len(iteratorMarkers)
+	}
 
 	if len(uerr.Errors) != numErrors {
 		t.Errorf("got %d errors, want %d", len(uerr.Errors), numErrors)
@@ -457,12 +1401,62 @@ func test(t *testing.T, f flags) {
 				t.Errorf("Expected assert at %s", k)
 			}
 		}
+		if iterators {
+		iterator_loop:
+			for k := range iteratorMarkers {
+				for _, e := range uerr.Errors {
+					if newMarker(e) == k {
+						continue iterator_loop
+					}
+				}
+				t.Errorf("Expected iterator at %s", k)
+			}
+		}
 	}
 
+	kindMarkers := map[ErrorKind]map[marker]bool{
+		UncheckedCall:      uncheckedMarkers,
+		BlankAssignment:    blankMarkers,
+		UncheckedAssertion: assertMarkers,
+		UncheckedIterator:  iteratorMarkers,
+	}
 	for i, err := range uerr.Errors {
 		m := marker{err.Pos.Filename, err.Pos.Line}
-		if !uncheckedMarkers[m] && !blankMarkers[m] && !assertMarkers[m] {
+		if !uncheckedMarkers[m] && !blankMarkers[m] && !assertMarkers[m] && !iteratorMarkers[m] {
 			t.Errorf("%d: unexpected error: %v", i, err)
+		} else if !kindMarkers[err.Kind][m] {
+			t.Errorf("%d: unexpected kind %v: %v", i, err.Kind, err)
+		}
+		// A sticky writer not flushed after its writes is reported once,
+		// naming its finalizer.
+		const flushMissing = "w.Flush is not called after it to report the error"
+		isMissing := err.EnclosingFunc == testPackage+".stickyFlushMissing" || err.EnclosingFunc == testPackage+".stickyFlushEarlier"
+		if isMissing != (err.Message == flushMissing) {
+			t.Errorf("%d: unexpected message %q: %v", i, err.Message, err)
 		}
 	}
 }
+
+// writeTestModule writes files, keyed by their slash-separated paths, to a
+// temporary directory and makes loadPackages load packages from it until the
+// test ends. It returns the directory.
+func writeTestModule(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, src := range files {
+		file := path.Join(dir, name)
+		if err := os.MkdirAll(path.Dir(file), 0755); err != nil {
+			t.Fatalf("MkdirAll failed: %v", err)
+		}
+		if err := ioutil.WriteFile(file, []byte(src), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	load := loadPackages
+	t.Cleanup(func() { loadPackages = load })
+	loadPackages = func(cfg *packages.Config, paths ...string) ([]*packages.Package, error) {
+		cfg.Dir = dir
+		return packages.Load(cfg, paths...)
+	}
+	return dir
+}
@@ -0,0 +1,302 @@
+package errcheck
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// ExcludeProfiles lists the names of the built-in exclude profiles, from the
+// smallest to the largest:
+//
+//   - "none" excludes nothing
+//   - "stdlib", the default, excludes functions in the Go standard library that
+//     have an error return type but are documented to never return an error
+//   - "extended" adds functions and methods that can only fail on misuse
+var ExcludeProfiles = []string{"none", "stdlib", "extended"}
+
+// DefaultExcludeProfile is the exclude profile used unless another is selected.
+const DefaultExcludeProfile = "stdlib"
+
+// stdlibExcludes are the entries of the "stdlib" exclude profile.
+var stdlibExcludes = []string{
+	// bufio
+	"sticky (*bufio.Writer).Flush",
+
+	// bytes
+	"(*bytes.Buffer).Write",
+	"(*bytes.Buffer).WriteByte",
+	"(*bytes.Buffer).WriteRune",
+	"(*bytes.Buffer).WriteString",
+
+	// compress/gzip
+	"sticky (*compress/gzip.Writer).Close",
+
+	// fmt
+	"fmt.Errorf",
+	"fmt.Print",
+	"fmt.Printf",
+	"fmt.Println",
+	"fmt.Fprint(*bytes.Buffer)",
+	"fmt.Fprintf(*bytes.Buffer)",
+	"fmt.Fprintln(*bytes.Buffer)",
+	"fmt.Fprint(*strings.Builder)",
+	"fmt.Fprintf(*strings.Builder)",
+	"fmt.Fprintln(*strings.Builder)",
+	"fmt.Fprint(os.Stderr)",
+	"fmt.Fprintf(os.Stderr)",
+	"fmt.Fprintln(os.Stderr)",
+
+	// math/rand
+	"math/rand.Read",
+	"(*math/rand.Rand).Read",
+
+	// strings
+	"(*strings.Builder).Write",
+	"(*strings.Builder).WriteByte",
+	"(*strings.Builder).WriteRune",
+	"(*strings.Builder).WriteString",
+
+	// hash
+	"(hash.Hash).Write",
+
+	// text/tabwriter
+	"sticky (*text/tabwriter.Writer).Flush",
+}
+
+// extendedExcludes are the entries added by the "extended" exclude profile.
+var extendedExcludes = []string{
+	// hash/maphash
+	"(*hash/maphash.Hash).Write",
+	"(*hash/maphash.Hash).WriteByte",
+	"(*hash/maphash.Hash).WriteString",
+
+	// io
+	"(*io.PipeReader).Close",
+	"(*io.PipeWriter).Close",
+	"(*io.PipeWriter).CloseWithError",
+}
+
+// profileEntries returns the entries of the named exclude profile, mapped to
+// the profile each one was added by. The empty name selects DefaultExcludeProfile.
+func profileEntries(name string) (map[string]string, error) {
+	entries := make(map[string]string)
+	add := func(profile string, l []string) {
+		for _, exc := range l {
+			entries[exc] = profile
+		}
+	}
+	switch name {
+	case "none":
+	case "", "stdlib":
+		add("stdlib", stdlibExcludes)
+	case "extended":
+		add("stdlib", stdlibExcludes)
+		add("extended", extendedExcludes)
+	default:
+		return nil, fmt.Errorf("unknown exclude profile %q", name)
+	}
+	return entries, nil
+}
+
+// ExcludeFunc is a predicate excluding calls from checking, for decisions
+// the exclude list cannot express. It is given the function called, the
+// call, the names the call is matched against the exclude list by, such as
+// "(*os.File).Write" and "(*os.File).Write[os.Stdout]", and the calling
+// package. It returns true if the call is excluded.
+type ExcludeFunc func(fn *types.Func, call *ast.CallExpr, names []string, pkg *packages.Package) bool
+
+// namedExcludeFunc is an ExcludeFunc along with the name identifying it in
+// suppression rules.
+type namedExcludeFunc struct {
+	name string
+	f    ExcludeFunc
+}
+
+// argMatch is the way an argument condition compares an argument to its target.
+type argMatch int
+
+const (
+	// argExact matches arguments whose type is the target, or which are
+	// the package-level variable named by the target.
+	argExact argMatch = iota
+	// argImplements matches arguments whose type implements the target interface.
+	argImplements
+	// argAssignable matches arguments whose type is assignable to the target type.
+	argAssignable
+)
+
+// argCondition restricts an exclude entry to calls whose argument at index
+// matches target.
+type argCondition struct {
+	index  int
+	match  argMatch
+	target string
+
+	// entry is the exclude entry the condition was parsed from.
+	entry string
+}
+
+// parseArgExclude parses an exclude entry of the form "NAME(CONDITION)", where
+// CONDITION is "[INDEX:][implements |assignable ]TARGET". It returns the
+// function name and the condition, and false if the entry has no condition.
+func parseArgExclude(entry string) (string, argCondition, bool) {
+	if !strings.HasSuffix(entry, ")") {
+		return "", argCondition{}, false
+	}
+	// Find the parenthesis opening the trailing condition.
+	depth := 0
+	open := -1
+	for i := len(entry) - 1; i >= 0 && open == -1; i-- {
+		switch entry[i] {
+		case ')':
+			depth++
+		case '(':
+			depth--
+			if depth == 0 {
+				open = i
+			}
+		}
+	}
+	if open <= 0 {
+		return "", argCondition{}, false
+	}
+	name, cond := entry[:open], entry[open+1:len(entry)-1]
+
+	c := argCondition{}
+	if colon := strings.Index(cond, ":"); colon != -1 {
+		if index, err := strconv.Atoi(cond[:colon]); err == nil && index >= 0 {
+			c.index = index
+			cond = cond[colon+1:]
+		}
+	}
+	switch {
+	case strings.HasPrefix(cond, "implements "):
+		c.match = argImplements
+		cond = cond[len("implements "):]
+	case strings.HasPrefix(cond, "assignable "):
+		c.match = argAssignable
+		cond = cond[len("assignable "):]
+	}
+	c.target = strings.TrimSpace(cond)
+	if c.target == "" {
+		return "", argCondition{}, false
+	}
+	return name, c, true
+}
+
+// argNames returns the names an argument can be matched against exactly: the
+// string form of its type and, if it refers to a package-level variable, the
+// package-qualified name of that variable, e.g. "os.Stdout".
+func (v *visitor) argNames(expr ast.Expr) []string {
+	var names []string
+	if name := v.packageLevelName(expr); name != "" {
+		names = append(names, name)
+	}
+	if t := v.pkg.TypesInfo.TypeOf(expr); t != nil {
+		names = append(names, t.String())
+	}
+	return names
+}
+
+// packageLevelName returns the package-qualified name, such as "os.Stdout", of
+// the package-level variable or constant expr refers to, or the empty string
+// if it does not refer to one.
+func (v *visitor) packageLevelName(expr ast.Expr) string {
+	var id *ast.Ident
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		id = expr
+	case *ast.SelectorExpr:
+		id = expr.Sel
+	default:
+		return ""
+	}
+	obj := v.pkg.TypesInfo.ObjectOf(id)
+	switch obj.(type) {
+	case *types.Var, *types.Const:
+	default:
+		return ""
+	}
+	if obj.Pkg() == nil || obj.Parent() != obj.Pkg().Scope() {
+		return ""
+	}
+	return obj.Pkg().Path() + "." + obj.Name()
+}
+
+// matchArg reports whether the argument of call selected by cond matches it.
+func (v *visitor) matchArg(call *ast.CallExpr, cond argCondition) bool {
+	if cond.index >= len(call.Args) {
+		return false
+	}
+	arg := call.Args[cond.index]
+
+	if cond.match == argExact {
+		for _, name := range v.argNames(arg) {
+			if name == cond.target {
+				return true
+			}
+		}
+		return false
+	}
+
+	at := v.pkg.TypesInfo.TypeOf(arg)
+	target := v.lookupType(cond.target)
+	if at == nil || target == nil {
+		return false
+	}
+	if cond.match == argImplements {
+		iface, ok := target.Underlying().(*types.Interface)
+		return ok && types.Implements(at, iface)
+	}
+	return types.AssignableTo(at, target)
+}
+
+// lookupType resolves a type name such as "*bytes.Buffer" or
+// "net/http.ResponseWriter" among the universe, the checked package and its
+// transitive imports. It returns nil if the type cannot be found.
+func (v *visitor) lookupType(name string) types.Type {
+	if strings.HasPrefix(name, "*") {
+		if elem := v.lookupType(name[1:]); elem != nil {
+			return types.NewPointer(elem)
+		}
+		return nil
+	}
+
+	dot := strings.LastIndex(name, ".")
+	if dot == -1 {
+		if tn, ok := types.Universe.Lookup(name).(*types.TypeName); ok {
+			return tn.Type()
+		}
+		return nil
+	}
+	pkg := findImport(v.pkg.Types, name[:dot], make(map[*types.Package]bool))
+	if pkg == nil {
+		return nil
+	}
+	if tn, ok := pkg.Scope().Lookup(name[dot+1:]).(*types.TypeName); ok {
+		return tn.Type()
+	}
+	return nil
+}
+
+// findImport returns the package with the given path among pkg and its transitive imports.
+func findImport(pkg *types.Package, path string, seen map[*types.Package]bool) *types.Package {
+	if pkg.Path() == path {
+		return pkg
+	}
+	seen[pkg] = true
+	for _, imp := range pkg.Imports() {
+		if seen[imp] {
+			continue
+		}
+		if found := findImport(imp, path, seen); found != nil {
+			return found
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package errcheck
+
+import "testing"
+
+func TestParseArgExclude(t *testing.T) {
+	cases := []struct {
+		entry string
+		ok    bool
+		name  string
+		cond  argCondition
+	}{
+		{"fmt.Printf", false, "", argCondition{}},
+		{"(*bytes.Buffer).Write", false, "", argCondition{}},
+		{"sticky (*bufio.Writer).Flush", false, "", argCondition{}},
+		{"fmt.Fprintf(*bytes.Buffer)", true, "fmt.Fprintf", argCondition{index: 0, match: argExact, target: "*bytes.Buffer"}},
+		{"fmt.Fprintf(os.Stderr)", true, "fmt.Fprintf", argCondition{index: 0, match: argExact, target: "os.Stderr"}},
+		{"io.Copy(1:*strings.Reader)", true, "io.Copy", argCondition{index: 1, match: argExact, target: "*strings.Reader"}},
+		{"fmt.Fprintf(implements net/http.ResponseWriter)", true, "fmt.Fprintf", argCondition{index: 0, match: argImplements, target: "net/http.ResponseWriter"}},
+		{"io.Copy(1:assignable io.Reader)", true, "io.Copy", argCondition{index: 1, match: argAssignable, target: "io.Reader"}},
+		{"(*example.com/p.T).Write(func())", true, "(*example.com/p.T).Write", argCondition{index: 0, match: argExact, target: "func()"}},
+		{"fmt.Fprintf()", false, "", argCondition{}},
+	}
+	for _, c := range cases {
+		name, cond, ok := parseArgExclude(c.entry)
+		if ok != c.ok || name != c.name || cond != c.cond {
+			t.Errorf("parseArgExclude(%q) got (%q, %+v, %v) want (%q, %+v, %v)", c.entry, name, cond, ok, c.name, c.cond, c.ok)
+		}
+	}
+}
+
+func TestExcludeProfiles(t *testing.T) {
+	sources := func(c *Checker) map[string]string {
+		m := make(map[string]string)
+		for _, e := range c.Excludes() {
+			m[e.Name] = e.Source
+		}
+		return m
+	}
+
+	c := NewChecker()
+	got := sources(c)
+	if len(got) != len(stdlibExcludes) || got["fmt.Printf"] != "stdlib" {
+		t.Errorf("default profile: got %d entries, fmt.Printf from %q", len(got), got["fmt.Printf"])
+	}
+
+	c.SetExclude(map[string]bool{"fmt.Printf": true, "example.com/p.F": true})
+	if err := c.SetExcludeProfile("extended"); err != nil {
+		t.Fatal(err)
+	}
+	got = sources(c)
+	if want := len(stdlibExcludes) + len(extendedExcludes) + 1; len(got) != want {
+		t.Errorf("extended profile: got %d entries, want %d", len(got), want)
+	}
+	for name, want := range map[string]string{
+		"fmt.Printf":             "exclude",
+		"example.com/p.F":        "exclude",
+		"fmt.Println":            "stdlib",
+		"(*io.PipeWriter).Close": "extended",
+	} {
+		if got[name] != want {
+			t.Errorf("extended profile: %s from %q, want %q", name, got[name], want)
+		}
+	}
+
+	if err := c.SetExcludeProfile("none"); err != nil {
+		t.Fatal(err)
+	}
+	got = sources(c)
+	if len(got) != 2 || len(c.sticky) != 0 {
+		t.Errorf("none profile: got %v, %d sticky types", got, len(c.sticky))
+	}
+
+	if err := c.SetExcludeProfile("bogus"); err == nil {
+		t.Error("expected an error for an unknown profile")
+	}
+}
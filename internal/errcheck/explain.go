@@ -0,0 +1,145 @@
+package errcheck
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path/filepath"
+)
+
+// CallExplanation describes how errcheck treats a single call.
+type CallExplanation struct {
+	// Pos is the position of the call, as mapped by any line directive,
+	// and Physical its position in the Go file.
+	Pos      token.Position
+	Physical token.Position
+
+	// Call is the source form of the call expression.
+	Call string
+
+	// Statement describes how the results of the call are used, e.g.
+	// "expression statement" or "assignment".
+	Statement string
+
+	// FuncName is the full name of the called function, if it can be resolved.
+	FuncName string
+
+	// ExcludeNames are the names checked against the exclude list, including
+	// those of any embedded interfaces the method is reached through.
+	ExcludeNames []string
+
+	// FirstArg are the names the first argument is matched against by
+	// exclude conditions: its type and any package-level variable it names.
+	FirstArg []string
+
+	// ErrorsByArg reports, for each result of the call, whether it is an error.
+	ErrorsByArg []bool
+
+	// ReturnsError is true if the call returns an error (or is a call to recover).
+	ReturnsError bool
+
+	// SuppressedBy describes the exclude or ignore rule matching the call, if any.
+	SuppressedBy string
+}
+
+// Explain loads the package containing filename and explains each call in
+// it that starts on the given line. If col is positive, only the calls
+// spanning that column are explained. The line and column are those of the
+// Go file, whatever line directives say.
+func (c *Checker) Explain(filename string, line, col int) ([]CallExplanation, error) {
+	filename, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	rules := c.excludeRules()
+	pkgs, err := c.load("", BuildConfig{}, "file="+filename)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pkg := range pkgs {
+		if len(pkg.Errors) > 0 {
+			return nil, fmt.Errorf("errors while loading package %s: %v", pkg.ID, pkg.Errors)
+		}
+		for _, file := range pkg.Syntax {
+			if pkg.Fset.PositionFor(file.Pos(), false).Filename != filename {
+				continue
+			}
+			v := c.newVisitor(pkg, rules)
+			if c.shouldSkipFile(file) {
+				c.logf(LogDebug, "%s is a generated file", filename)
+				v.suppressAll = "generated-code"
+			}
+			v.prepareFile(file)
+			return v.explain(file, line, col), nil
+		}
+	}
+	return nil, fmt.Errorf("no package contains %s", filename)
+}
+
+func (v *visitor) explain(file *ast.File, line, col int) []CallExplanation {
+	var explanations []CallExplanation
+	var parents []ast.Node
+	ast.Inspect(file, func(node ast.Node) bool {
+		if node == nil {
+			parents = parents[:len(parents)-1]
+			return true
+		}
+		defer func() { parents = append(parents, node) }()
+
+		call, ok := node.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		start, end := v.pkg.Fset.PositionFor(call.Pos(), false), v.pkg.Fset.PositionFor(call.End(), false)
+		if start.Line != line {
+			return true
+		}
+		if col > 0 && (col < start.Column || (end.Line == line && col >= end.Column)) {
+			return true
+		}
+
+		parent := parents[len(parents)-1]
+		e := CallExplanation{
+			Pos:          v.pkg.Fset.Position(call.Pos()),
+			Physical:     start,
+			Call:         types.ExprString(call),
+			Statement:    statementKind(parent),
+			FuncName:     v.fullName(call),
+			ExcludeNames: v.namesForExcludeCheck(call),
+			ErrorsByArg:  v.errorsByArg(call),
+			ReturnsError: v.callReturnsError(call),
+		}
+		if _, ok := parent.(*ast.DeferStmt); ok {
+			e.SuppressedBy, _ = v.deferredCallRule(call)
+		} else {
+			e.SuppressedBy = v.suppressedBy(call)
+		}
+		if len(call.Args) > 0 {
+			e.FirstArg = v.argNames(call.Args[0])
+		}
+		explanations = append(explanations, e)
+		return true
+	})
+	return explanations
+}
+
+// statementKind describes how a call with the given parent node uses its results.
+func statementKind(parent ast.Node) string {
+	switch parent.(type) {
+	case *ast.ExprStmt:
+		return "expression statement"
+	case *ast.GoStmt:
+		return "go statement"
+	case *ast.DeferStmt:
+		return "defer statement"
+	case *ast.AssignStmt:
+		return "assignment"
+	case *ast.ValueSpec:
+		return "variable declaration"
+	case *ast.ReturnStmt:
+		return "return statement"
+	}
+	return "expression"
+}
@@ -0,0 +1,165 @@
+package errcheck
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strings"
+)
+
+// IteratorType describes a type whose iteration method reports failure only
+// by stopping, leaving the error to be retrieved afterwards from an accessor,
+// like bufio.Scanner's Scan and Err methods.
+type IteratorType struct {
+	// Type is the receiver type, e.g. "*bufio.Scanner".
+	Type string
+
+	// Advance is the name of the iteration method, e.g. "Scan".
+	Advance string
+
+	// Err is the name of the method returning the deferred error, e.g. "Err".
+	Err string
+}
+
+// String returns the iterator type in the form accepted by ParseIteratorType,
+// e.g. "(*bufio.Scanner).Scan:Err".
+func (t IteratorType) String() string {
+	return fmt.Sprintf("(%s).%s:%s", t.Type, t.Advance, t.Err)
+}
+
+// ParseIteratorType parses an iterator type of the form "(TYPE).ADVANCE:ERR".
+func ParseIteratorType(s string) (IteratorType, error) {
+	colon := strings.LastIndex(s, ":")
+	dot := strings.LastIndex(s, ").")
+	if !strings.HasPrefix(s, "(") || dot == -1 || colon < dot {
+		return IteratorType{}, fmt.Errorf("invalid iterator type %q, want (TYPE).ADVANCE:ERR", s)
+	}
+	t := IteratorType{
+		Type:    s[1:dot],
+		Advance: s[dot+2 : colon],
+		Err:     s[colon+1:],
+	}
+	if t.Type == "" || t.Advance == "" || t.Err == "" {
+		return IteratorType{}, fmt.Errorf("invalid iterator type %q, want (TYPE).ADVANCE:ERR", s)
+	}
+	return t, nil
+}
+
+// DefaultIteratorTypes are the standard library iterator types checked when
+// Checker.Iterators is set.
+var DefaultIteratorTypes = []IteratorType{
+	{Type: "*bufio.Scanner", Advance: "Scan", Err: "Err"},
+	{Type: "*database/sql.Rows", Advance: "Next", Err: "Err"},
+	{Type: "*database/sql.Rows", Advance: "NextResultSet", Err: "Err"},
+}
+
+// iteratorUse tracks how a variable holding an iterator is used within a function.
+type iteratorUse struct {
+	advance  *ast.CallExpr // first call of the iteration method
+	consults bool          // whether the error accessor is called
+	escapes  bool          // whether the value is used other than as a method receiver
+}
+
+// checkIterators reports every function in file that advances an iterator
+// held in a variable declared in its body without consulting its deferred error.
+func (v *visitor) checkIterators(file *ast.File) {
+	forEachFunc(file, v.checkIteratorsIn)
+}
+
+// forEachFunc calls f with the body of every top-level function in file.
+// The bodies of function literals nested in another function are not passed
+// separately.
+func forEachFunc(file *ast.File, f func(body *ast.BlockStmt)) {
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok {
+			if fn.Body != nil {
+				f(fn.Body)
+			}
+			continue
+		}
+		// Function literals in package-level variable initializers.
+		ast.Inspect(decl, func(node ast.Node) bool {
+			if lit, ok := node.(*ast.FuncLit); ok {
+				f(lit.Body)
+				return false
+			}
+			return true
+		})
+	}
+}
+
+// checkIteratorsIn checks a function body, including any function literals it contains.
+func (v *visitor) checkIteratorsIn(body *ast.BlockStmt) {
+	uses := make(map[*types.Var]*iteratorUse)
+	receivers := make(map[*ast.Ident]bool)
+
+	ast.Inspect(body, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		id, ok := sel.X.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		obj, ok := v.pkg.TypesInfo.Uses[id].(*types.Var)
+		if !ok {
+			return true
+		}
+		receivers[id] = true
+		if obj.Pos() < body.Pos() || obj.Pos() >= body.End() {
+			// Parameters and package-level variables may be
+			// consulted by the caller or other functions.
+			return true
+		}
+
+		typeName := types.TypeString(obj.Type(), nil)
+		for _, it := range v.iterators {
+			if it.Type != typeName {
+				continue
+			}
+			use, ok := uses[obj]
+			if !ok {
+				use = &iteratorUse{}
+				uses[obj] = use
+			}
+			switch sel.Sel.Name {
+			case it.Advance:
+				if use.advance == nil {
+					use.advance = call
+				}
+			case it.Err:
+				use.consults = true
+			}
+		}
+		return true
+	})
+	if len(uses) == 0 {
+		return
+	}
+
+	// Any other use of the variable, such as passing it to a function or
+	// returning it, may consult the error elsewhere.
+	ast.Inspect(body, func(node ast.Node) bool {
+		id, ok := node.(*ast.Ident)
+		if !ok || receivers[id] {
+			return true
+		}
+		if obj, ok := v.pkg.TypesInfo.Uses[id].(*types.Var); ok {
+			if use, ok := uses[obj]; ok {
+				use.escapes = true
+			}
+		}
+		return true
+	})
+
+	for _, use := range uses {
+		if use.advance != nil && !use.consults && !use.escapes {
+			v.addCallError(use.advance.Lparen, use.advance, UncheckedIterator, v.suppressedBy(use.advance))
+		}
+	}
+}
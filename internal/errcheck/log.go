@@ -0,0 +1,58 @@
+package errcheck
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// LogLevel is the level of detail of a log message.
+type LogLevel int
+
+const (
+	// LogInfo messages report progress, such as the packages being checked.
+	LogInfo LogLevel = iota
+	// LogDebug messages explain how packages are loaded and files selected.
+	LogDebug
+	// LogTrace messages explain the exclude and ignore decision for each call.
+	LogTrace
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogInfo:
+		return "info"
+	case LogDebug:
+		return "debug"
+	case LogTrace:
+		return "trace"
+	}
+	return fmt.Sprintf("LogLevel(%d)", int(l))
+}
+
+// Logger receives the log messages of a Checker. Logf may be called
+// concurrently while packages are checked.
+type Logger interface {
+	Logf(level LogLevel, format string, args ...interface{})
+}
+
+// NewLogger returns a Logger writing the messages up to the given level to w,
+// one per line.
+func NewLogger(w io.Writer, level LogLevel) Logger {
+	return &writerLogger{w: w, level: level}
+}
+
+type writerLogger struct {
+	mu    sync.Mutex
+	w     io.Writer
+	level LogLevel
+}
+
+func (l *writerLogger) Logf(level LogLevel, format string, args ...interface{}) {
+	if level > l.level {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintf(l.w, "%s: "+format+"\n", append([]interface{}{level}, args...)...)
+}
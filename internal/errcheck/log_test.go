@@ -0,0 +1,19 @@
+package errcheck
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewLogger(&buf, LogDebug)
+	l.Logf(LogInfo, "checking %s", "p")
+	l.Logf(LogDebug, "loaded %d packages", 1)
+	l.Logf(LogTrace, "call %s", "f")
+
+	want := "info: checking p\ndebug: loaded 1 packages\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
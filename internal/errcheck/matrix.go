@@ -0,0 +1,79 @@
+package errcheck
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+// BuildConfig is a build configuration packages are checked in.
+type BuildConfig struct {
+	// GOOS and GOARCH select the target platform. If empty, the values of
+	// the environment are used.
+	GOOS   string
+	GOARCH string
+
+	// Tags are build tags, in addition to Checker.Tags.
+	Tags []string
+}
+
+// String describes the configuration, such as "linux/amd64" or
+// "windows/arm64 [integration e2e]".
+func (b BuildConfig) String() string {
+	var parts []string
+	if b.GOOS != "" || b.GOARCH != "" {
+		parts = append(parts, b.GOOS+"/"+b.GOARCH)
+	}
+	if len(b.Tags) > 0 {
+		parts = append(parts, "["+strings.Join(b.Tags, " ")+"]")
+	}
+	if len(parts) == 0 {
+		return "default"
+	}
+	return strings.Join(parts, " ")
+}
+
+// env returns the environment selecting the platform of b, or nil to use
+// that of the current process unchanged.
+func (b BuildConfig) env() []string {
+	if b.GOOS == "" && b.GOARCH == "" {
+		return nil
+	}
+	env := os.Environ()
+	if b.GOOS != "" {
+		env = append(env, "GOOS="+b.GOOS)
+	}
+	if b.GOARCH != "" {
+		env = append(env, "GOARCH="+b.GOARCH)
+	}
+	return env
+}
+
+// annotate records that the errors of r are found in config.
+func (r *Result) annotate(config string) {
+	for i := range r.Errors {
+		r.Errors[i].Configs = []string{config}
+	}
+	for i := range r.Suppressed {
+		r.Suppressed[i].Configs = []string{config}
+	}
+}
+
+// sortedUnion returns the sorted union of a, which must be sorted, and b,
+// such as the configurations errors are found in.
+func sortedUnion(a, b []string) []string {
+	if len(b) == 0 {
+		return a
+	}
+	merged := append([]string{}, a...)
+	for _, config := range b {
+		i := sort.SearchStrings(merged, config)
+		if i < len(merged) && merged[i] == config {
+			continue
+		}
+		merged = append(merged, "")
+		copy(merged[i+1:], merged[i:])
+		merged[i] = config
+	}
+	return merged
+}
@@ -0,0 +1,74 @@
+package errcheck
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// FindModules returns the absolute directories of the modules to check
+// beneath root. If root contains a go.work file, they are the modules it
+// uses; otherwise they are the directories containing a go.mod file,
+// skipping vendor and testdata directories and those starting with "." or
+// "_", which the go command ignores too.
+func FindModules(root string) ([]string, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	work := filepath.Join(root, "go.work")
+	data, err := ioutil.ReadFile(work)
+	switch {
+	case err == nil:
+		return workModules(work, data)
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+
+	var dirs []string
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			name := info.Name()
+			if path != root && (name == "vendor" || name == "testdata" ||
+				strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Name() == "go.mod" {
+			dirs = append(dirs, filepath.Dir(path))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(dirs)
+	return dirs, nil
+}
+
+// workModules returns the absolute directories of the modules used by the
+// go.work file named work.
+func workModules(work string, data []byte) ([]string, error) {
+	f, err := modfile.ParseWork(work, data, nil)
+	if err != nil {
+		return nil, err
+	}
+	dirs := make([]string, 0, len(f.Use))
+	for _, use := range f.Use {
+		dir := filepath.FromSlash(use.Path)
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(filepath.Dir(work), dir)
+		}
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	return dirs, nil
+}
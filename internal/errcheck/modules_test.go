@@ -0,0 +1,63 @@
+package errcheck
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFindModules(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "testfindmodules")
+	if err != nil {
+		t.Fatalf("unable to create testfindmodules directory: %v", err)
+	}
+	defer func() {
+		os.RemoveAll(tmpDir)
+	}()
+	// TempDir may be a symbolic link, while FindModules returns absolute paths.
+	if tmpDir, err = filepath.EvalSymlinks(tmpDir); err != nil {
+		t.Fatalf("EvalSymlinks failed: %v", err)
+	}
+
+	for _, name := range []string{
+		"go.mod",
+		"a/go.mod",
+		"a/nested/b/go.mod",
+		"vendor/example.com/v/go.mod",
+		"testdata/go.mod",
+		".git/go.mod",
+		"_old/go.mod",
+	} {
+		name = filepath.Join(tmpDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatalf("MkdirAll failed: %v", err)
+		}
+		if err := ioutil.WriteFile(name, []byte("module example.com/m\n"), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	dirs, err := FindModules(tmpDir)
+	if err != nil {
+		t.Fatalf("FindModules failed: %v", err)
+	}
+	want := []string{tmpDir, filepath.Join(tmpDir, "a"), filepath.Join(tmpDir, "a", "nested", "b")}
+	if !reflect.DeepEqual(dirs, want) {
+		t.Errorf("without go.work got %v, want %v", dirs, want)
+	}
+
+	const work = "go 1.18\n\nuse (\n\t./a/nested/b\n\t./_old\n)\n"
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, "go.work"), []byte(work), 0644); err != nil {
+		t.Fatalf("Failed to write go.work: %v", err)
+	}
+	dirs, err = FindModules(tmpDir)
+	if err != nil {
+		t.Fatalf("FindModules failed: %v", err)
+	}
+	want = []string{filepath.Join(tmpDir, "_old"), filepath.Join(tmpDir, "a", "nested", "b")}
+	if !reflect.DeepEqual(dirs, want) {
+		t.Errorf("with go.work got %v, want %v", dirs, want)
+	}
+}
@@ -0,0 +1,208 @@
+package errcheck
+
+import (
+	"fmt"
+	"go/ast"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// Result is the outcome of checking packages with Run.
+type Result struct {
+	// Errors are the unchecked errors, sorted by position.
+	Errors []UncheckedError
+
+	// Suppressed are the unchecked errors not reported because of an
+	// exclude or ignore rule, sorted by position. They are only collected
+	// if Checker.ShowSuppressed is set.
+	Suppressed []UncheckedError
+
+	// Diagnostics are the errors of the packages that failed to load,
+	// which are not checked.
+	Diagnostics []PackageError
+
+	// Packages are the import paths of the packages checked, sorted.
+	Packages []string
+
+	Stats Stats
+}
+
+// Stats are statistics about a run of the Checker. Packages checked in
+// several build configurations are counted in each.
+type Stats struct {
+	// Packages and Files are the numbers of packages and files checked.
+	Packages int
+	Files    int
+
+	// GeneratedFiles is the number of files skipped as generated code.
+	GeneratedFiles int
+
+	// Calls is the number of calls inspected in the files checked, and
+	// ErrorCalls the number of those returning an error.
+	Calls      int
+	ErrorCalls int
+
+	// Kinds is the number of unchecked errors of each kind.
+	Kinds map[ErrorKind]int
+
+	// LoadTime is the time spent loading and type checking the packages,
+	// and CheckTime the time spent checking them.
+	LoadTime  time.Duration
+	CheckTime time.Duration
+}
+
+// PackageError reports the errors encountered while loading a package.
+type PackageError struct {
+	Package string
+	Errors  []packages.Error
+}
+
+func (e PackageError) Error() string {
+	return fmt.Sprintf("errors while loading package %s: %v", e.Package, e.Errors)
+}
+
+// Run checks packages for errors. Packages that fail to load are reported
+// in the Diagnostics of the result and not checked; the error is only set
+// if the packages cannot be loaded at all.
+//
+// Run may be called concurrently, including with the methods changing the
+// exclude rules; a run uses the rules in effect when it starts. The exported
+// fields of the Checker must not be changed while it runs.
+func (c *Checker) Run(paths ...string) (*Result, error) {
+	return c.run(c.excludeRules(), "", paths...)
+}
+
+// RunModules is like Run, but checks the packages matching paths in each of
+// the module directories dirs, as listed by FindModules, and merges the
+// results. Relative paths are resolved in each module directory.
+func (c *Checker) RunModules(dirs []string, paths ...string) (*Result, error) {
+	rules := c.excludeRules()
+	r := &Result{Stats: Stats{Kinds: make(map[ErrorKind]int)}}
+	for _, dir := range dirs {
+		c.logf(LogDebug, "checking module in %s", dir)
+		mr, err := c.run(rules, dir, paths...)
+		if err != nil {
+			return nil, fmt.Errorf("checking module in %s: %v", dir, err)
+		}
+		r.merge(mr)
+	}
+	return r, nil
+}
+
+// run checks the packages matching paths in dir, in each of c.Configs, with
+// the given exclude rules.
+func (c *Checker) run(rules excludeRules, dir string, paths ...string) (*Result, error) {
+	if len(c.Configs) == 0 {
+		return c.runConfig(rules, dir, BuildConfig{}, paths...)
+	}
+	r := &Result{Stats: Stats{Kinds: make(map[ErrorKind]int)}}
+	for _, config := range c.Configs {
+		c.logf(LogDebug, "checking configuration %s", config)
+		cr, err := c.runConfig(rules, dir, config, paths...)
+		if err != nil {
+			return nil, fmt.Errorf("checking configuration %s: %v", config, err)
+		}
+		cr.annotate(config.String())
+		r.merge(cr)
+	}
+	return r, nil
+}
+
+// runConfig checks the packages matching paths in dir in config with the
+// given exclude rules.
+func (c *Checker) runConfig(rules excludeRules, dir string, config BuildConfig, paths ...string) (*Result, error) {
+	start := time.Now()
+	pkgs, err := c.load(dir, config, paths...)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Result{Stats: Stats{Kinds: make(map[ErrorKind]int)}}
+	r.Stats.LoadTime = time.Since(start)
+	start = time.Now()
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	for _, pkg := range pkgs {
+		if len(pkg.Errors) > 0 {
+			r.Diagnostics = append(r.Diagnostics, PackageError{Package: pkg.ID, Errors: pkg.Errors})
+			continue
+		}
+		wg.Add(1)
+
+		go func(pkg *packages.Package) {
+			defer wg.Done()
+			c.logf(LogInfo, "Checking %s", pkg.Types.Path())
+
+			v := c.newVisitor(pkg, rules)
+
+			var generated int
+			for _, astFile := range v.pkg.Syntax {
+				v.pass.File = astFile
+				if c.shouldSkipFile(astFile) {
+					c.logf(LogDebug, "skipping generated file %s", pkg.Fset.Position(astFile.Pos()).Filename)
+					generated++
+					if c.ShowSuppressed {
+						// The calls of skipped files are not counted.
+						calls, errorCalls := v.calls, v.errorCalls
+						v.suppressAll = "generated-code"
+						ast.Walk(v, astFile)
+						v.suppressAll = ""
+						v.calls, v.errorCalls = calls, errorCalls
+					}
+					continue
+				}
+				v.prepareFile(astFile)
+				ast.Walk(v, astFile)
+				if c.Iterators {
+					v.checkIterators(astFile)
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			r.Errors = append(r.Errors, v.errors...)
+			r.Suppressed = append(r.Suppressed, v.suppressed...)
+			r.Packages = append(r.Packages, pkg.PkgPath)
+			r.Stats.Packages++
+			r.Stats.Files += len(v.pkg.Syntax) - generated
+			r.Stats.GeneratedFiles += generated
+			r.Stats.Calls += v.calls
+			r.Stats.ErrorCalls += v.errorCalls
+		}(pkg)
+	}
+	wg.Wait()
+
+	r.Errors = sortErrors(r.Errors)
+	r.Suppressed = sortErrors(r.Suppressed)
+	r.Packages = sortedUnion(nil, r.Packages)
+	for _, e := range r.Errors {
+		r.Stats.Kinds[e.Kind]++
+	}
+	r.Stats.CheckTime = time.Since(start)
+	return r, nil
+}
+
+// merge adds the errors, diagnostics, packages and statistics of o to r.
+func (r *Result) merge(o *Result) {
+	r.Errors = sortErrors(append(r.Errors, o.Errors...))
+	r.Suppressed = sortErrors(append(r.Suppressed, o.Suppressed...))
+	r.Diagnostics = append(r.Diagnostics, o.Diagnostics...)
+	r.Packages = sortedUnion(r.Packages, o.Packages)
+
+	r.Stats.Packages += o.Stats.Packages
+	r.Stats.Files += o.Stats.Files
+	r.Stats.GeneratedFiles += o.Stats.GeneratedFiles
+	r.Stats.Calls += o.Stats.Calls
+	r.Stats.ErrorCalls += o.Stats.ErrorCalls
+	r.Stats.LoadTime += o.Stats.LoadTime
+	r.Stats.CheckTime += o.Stats.CheckTime
+	r.Stats.Kinds = make(map[ErrorKind]int)
+	for _, e := range r.Errors {
+		r.Stats.Kinds[e.Kind]++
+	}
+}
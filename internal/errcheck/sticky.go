@@ -0,0 +1,171 @@
+package errcheck
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strings"
+)
+
+// stickyPrefix introduces exclude entries declaring sticky error types.
+//
+// A sticky error type, such as *bufio.Writer, stores the first error
+// encountered by any of its methods and reports it again from a finalizer
+// method such as Flush. The entry "sticky (*bufio.Writer).Flush" excludes
+// method calls on a *bufio.Writer that are followed by a call to its Flush
+// method in the same function, leaving that call to be checked instead.
+const stickyPrefix = "sticky "
+
+// stickyType is a sticky error type parsed from an exclude entry.
+type stickyType struct {
+	entry     string // e.g. "sticky (*bufio.Writer).Flush"
+	typ       string // e.g. "*bufio.Writer"
+	finalizer string // e.g. "Flush"
+}
+
+// parseStickyType parses an exclude entry of the form "sticky (TYPE).FINALIZER".
+func parseStickyType(entry string) (stickyType, bool) {
+	if !strings.HasPrefix(entry, stickyPrefix) {
+		return stickyType{}, false
+	}
+	name := strings.TrimSpace(entry[len(stickyPrefix):])
+	dot := strings.LastIndex(name, ").")
+	if !strings.HasPrefix(name, "(") || dot == -1 {
+		return stickyType{}, false
+	}
+	t := stickyType{entry: entry, typ: name[1:dot], finalizer: name[dot+2:]}
+	if t.typ == "" || t.finalizer == "" {
+		return stickyType{}, false
+	}
+	return t, true
+}
+
+// stickyCall is a method call on a variable of a sticky error type.
+type stickyCall struct {
+	call     *ast.CallExpr
+	typ      stickyType
+	deferred bool
+}
+
+// findStickyWrites records in v.stickyExempt the method calls on variables of
+// sticky error types in file whose errors are reported by a finalizer call on
+// the same variable, deferred or later in the function, along with the type
+// exempting them. The finalizer call is checked like any other. If there is
+// no such call, only the first of the calls dropping their error is left to
+// be reported, with v.stickyMissing holding a message naming the finalizer,
+// and the others are exempted.
+func (v *visitor) findStickyWrites(file *ast.File) {
+	if len(v.sticky) == 0 {
+		return
+	}
+	forEachFunc(file, v.findStickyWritesIn)
+}
+
+func (v *visitor) findStickyWritesIn(body *ast.BlockStmt) {
+	calls := make(map[*types.Var][]stickyCall)
+	finalizers := make(map[*types.Var][]stickyCall)
+	names := make(map[*types.Var]string)
+
+	// discarded holds the calls whose results are dropped, and blank those
+	// whose errors are assigned to blank identifiers.
+	discarded := make(map[*ast.CallExpr]bool)
+	blank := make(map[*ast.CallExpr]bool)
+	// deferredCalls holds the deferred calls, and deferredFuncs the bodies
+	// of deferred function literals.
+	deferredCalls := make(map[*ast.CallExpr]bool)
+	var deferredFuncs []*ast.BlockStmt
+	isDeferred := func(call *ast.CallExpr) bool {
+		if deferredCalls[call] {
+			return true
+		}
+		for _, b := range deferredFuncs {
+			if b.Pos() <= call.Pos() && call.End() <= b.End() {
+				return true
+			}
+		}
+		return false
+	}
+
+	ast.Inspect(body, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.DeferStmt:
+			discarded[node.Call] = true
+			deferredCalls[node.Call] = true
+			if lit, ok := node.Call.Fun.(*ast.FuncLit); ok {
+				deferredFuncs = append(deferredFuncs, lit.Body)
+			}
+		case *ast.GoStmt:
+			discarded[node.Call] = true
+		case *ast.ExprStmt:
+			if call, ok := node.X.(*ast.CallExpr); ok {
+				discarded[call] = true
+			}
+		case *ast.AssignStmt:
+			if call, ok := node.Rhs[0].(*ast.CallExpr); ok && len(node.Rhs) == 1 {
+				blank[call] = v.errorsDiscarded(call, node.Lhs)
+			}
+		case *ast.CallExpr:
+			sel, ok := node.Fun.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			id, ok := sel.X.(*ast.Ident)
+			if !ok {
+				return true
+			}
+			obj, ok := v.pkg.TypesInfo.Uses[id].(*types.Var)
+			if !ok {
+				return true
+			}
+			typeName := types.TypeString(obj.Type(), nil)
+			for _, st := range v.sticky {
+				if st.typ != typeName {
+					continue
+				}
+				names[obj] = id.Name
+				c := stickyCall{call: node, typ: st, deferred: isDeferred(node)}
+				if sel.Sel.Name != st.finalizer {
+					calls[obj] = append(calls[obj], c)
+				} else {
+					finalizers[obj] = append(finalizers[obj], c)
+				}
+			}
+		}
+		return true
+	})
+
+	for obj, cs := range calls {
+		reported := false
+		for _, c := range cs {
+			finalized := false
+			for _, f := range finalizers[obj] {
+				if f.deferred || f.call.Pos() > c.call.Pos() {
+					finalized = true
+					break
+				}
+			}
+			dropped := discarded[c.call] || v.blank && blank[c.call]
+			if !finalized && !reported && dropped && v.findSuppression(c.call) == "" {
+				reported = true
+				v.stickyMissing[c.call] = fmt.Sprintf("%s.%s is not called after it to report the error", names[obj], c.typ.finalizer)
+				continue
+			}
+			v.stickyExempt[c.call] = c.typ
+		}
+	}
+}
+
+// errorsDiscarded reports whether every error result of call is assigned to
+// a blank identifier in lhs.
+func (v *visitor) errorsDiscarded(call *ast.CallExpr, lhs []ast.Expr) bool {
+	isError := v.errorsByArg(call)
+	if len(isError) != len(lhs) {
+		return false
+	}
+	for i, e := range lhs {
+		if id, ok := e.(*ast.Ident); isError[i] && (!ok || id.Name != "_") {
+			return false
+		}
+	}
+	return true
+}
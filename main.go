@@ -2,13 +2,20 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"go/token"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"text/template"
 
 	"github.com/kisielk/errcheck/internal/errcheck"
 )
@@ -19,7 +26,32 @@ const (
 	exitFatalError
 )
 
-var abspath bool
+var (
+	abspath bool
+
+	// newFromRev and newFromPatch restrict the report to lines changed
+	// relative to a git revision or by a unified diff.
+	newFromRev   string
+	newFromPatch string
+
+	// staged checks the contents of the git index instead of the working tree.
+	staged bool
+
+	// modules checks every module of the go.work file in the current
+	// directory or, without one, every module beneath it.
+	modules bool
+
+	// format selects the report format: text, checkstyle or junit.
+	format string
+
+	// formatTemplate, if set, renders each error instead of format.
+	formatTemplate *template.Template
+
+	// emitExcludes prints an exclude file covering the unchecked errors
+	// instead of reporting them, optionally grouped by package.
+	emitExcludes          bool
+	emitExcludesByPackage bool
+)
 
 type ignoreFlag map[string]*regexp.Regexp
 
@@ -80,76 +112,552 @@ func (f *tagsFlag) Set(s string) error {
 	return nil
 }
 
+// platformsFlag lists the GOOS/GOARCH pairs given to -matrix.
+type platformsFlag []errcheck.BuildConfig
+
+func (f *platformsFlag) String() string {
+	names := make([]string, len(*f))
+	for i, p := range *f {
+		names[i] = p.String()
+	}
+	return fmt.Sprintf("%q", strings.Join(names, ","))
+}
+
+func (f *platformsFlag) Set(s string) error {
+	for _, name := range strings.Split(s, ",") {
+		if name == "" {
+			continue
+		}
+		parts := strings.Split(name, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("invalid platform %q, want GOOS/GOARCH", name)
+		}
+		*f = append(*f, errcheck.BuildConfig{GOOS: parts[0], GOARCH: parts[1]})
+	}
+	return nil
+}
+
+// tagSetsFlag lists the tag sets given to -matrix-tags, one per use.
+type tagSetsFlag [][]string
+
+func (f *tagSetsFlag) String() string {
+	sets := make([]string, len(*f))
+	for i, tags := range *f {
+		sets[i] = strings.Join(tags, " ")
+	}
+	return fmt.Sprintf("%q", sets)
+}
+
+func (f *tagSetsFlag) Set(s string) error {
+	*f = append(*f, strings.Fields(s))
+	return nil
+}
+
+// buildMatrix returns the configurations combining each platform with each
+// tag set. Either may be empty, in which case the other is used alone.
+func buildMatrix(platforms []errcheck.BuildConfig, tagSets [][]string) []errcheck.BuildConfig {
+	if len(platforms) == 0 {
+		platforms = []errcheck.BuildConfig{{}}
+	}
+	if len(tagSets) == 0 {
+		tagSets = [][]string{nil}
+	}
+	var configs []errcheck.BuildConfig
+	for _, p := range platforms {
+		for _, tags := range tagSets {
+			configs = append(configs, errcheck.BuildConfig{GOOS: p.GOOS, GOARCH: p.GOARCH, Tags: tags})
+		}
+	}
+	return configs
+}
+
+type iteratorsFlag []errcheck.IteratorType
+
+func (f *iteratorsFlag) String() string {
+	names := make([]string, len(*f))
+	for i, it := range *f {
+		names[i] = it.String()
+	}
+	return fmt.Sprintf("%q", strings.Join(names, ","))
+}
+
+func (f *iteratorsFlag) Set(s string) error {
+	for _, name := range strings.Split(s, ",") {
+		if name == "" {
+			continue
+		}
+		it, err := errcheck.ParseIteratorType(name)
+		if err != nil {
+			return err
+		}
+		*f = append(*f, it)
+	}
+	return nil
+}
+
 var dotStar = regexp.MustCompile(".*")
 
+// relativePos returns the position as a string, relative to wd unless abspath is set.
+func relativePos(wd string, position token.Position) string {
+	return relativePath(wd, position.String())
+}
+
+// relativePath returns path relative to wd unless abspath is set.
+func relativePath(wd, path string) string {
+	if !abspath {
+		newPath, err := filepath.Rel(wd, path)
+		if err == nil {
+			path = newPath
+		}
+	}
+	return path
+}
+
 func reportUncheckedErrors(e *errcheck.UncheckedErrors, verbose bool) {
 	wd, err := os.Getwd()
 	if err != nil {
 		wd = ""
 	}
 	for _, uncheckedError := range e.Errors {
-		pos := uncheckedError.Pos.String()
-		if !abspath {
-			newPos, err := filepath.Rel(wd, pos)
-			if err == nil {
-				pos = newPos
-			}
-		}
+		pos := relativePos(wd, uncheckedError.Pos)
 
+		line := findingSource(uncheckedError)
+		var notes []string
+		if uncheckedError.Message != "" {
+			notes = append(notes, uncheckedError.Message)
+		}
+		if len(uncheckedError.Configs) > 0 {
+			notes = append(notes, "in "+strings.Join(uncheckedError.Configs, ", "))
+		}
+		if len(notes) > 0 {
+			line += "\t// " + strings.Join(notes, "; ")
+		}
 		if verbose && uncheckedError.FuncName != "" {
-			fmt.Printf("%s:\t%s\t%s\n", pos, uncheckedError.FuncName, uncheckedError.Line)
+			fmt.Printf("%s:\t%s\t%s\n", pos, uncheckedError.FuncName, line)
 		} else {
-			fmt.Printf("%s:\t%s\n", pos, uncheckedError.Line)
+			fmt.Printf("%s:\t%s\n", pos, line)
+		}
+	}
+}
+
+// reportSuppressed prints the suppressed errors annotated with the rule that
+// suppressed them, followed by the number of calls suppressed by each rule.
+func reportSuppressed(e *errcheck.UncheckedErrors, ignore map[string]*regexp.Regexp) {
+	wd, err := os.Getwd()
+	if err != nil {
+		wd = ""
+	}
+	counts := make(map[string]int)
+	for _, suppressed := range e.Suppressed {
+		rule := suppressionRule(suppressed.SuppressedBy, ignore)
+		counts[rule]++
+		fmt.Printf("%s:\t%s\t// suppressed by %s\n", relativePos(wd, suppressed.Pos), suppressed.Line, rule)
+	}
+
+	rules := make([]string, 0, len(counts))
+	for rule := range counts {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if counts[rules[i]] != counts[rules[j]] {
+			return counts[rules[i]] > counts[rules[j]]
 		}
+		return rules[i] < rules[j]
+	})
+	fmt.Printf("%d suppressed calls\n", len(e.Suppressed))
+	for _, rule := range rules {
+		fmt.Printf("%6d\t%s\n", counts[rule], rule)
 	}
 }
 
+// suppressionRule returns the rule an ignore pattern was given by, which is
+// -ignorepkg for the patterns it adds to the ignore map.
+func suppressionRule(rule string, ignore map[string]*regexp.Regexp) string {
+	const prefix = "ignore: "
+	if !strings.HasPrefix(rule, prefix) {
+		return rule
+	}
+	pkg := strings.SplitN(rule[len(prefix):], ":", 2)[0]
+	if ignore[pkg] == dotStar {
+		return "ignorepkg: " + pkg
+	}
+	return rule
+}
+
 func mainCmd(args []string) int {
 	runtime.GOMAXPROCS(runtime.NumCPU())
 
+	if len(args) > 1 && args[1] == "explain" {
+		return explainCmd(args[1:])
+	}
+	if len(args) > 1 && args[1] == "excludes" {
+		return excludesCmd(args[1:])
+	}
+
 	checker := errcheck.NewChecker()
 	paths, err := parseFlags(checker, args)
 	if err != exitCodeOk {
 		return err
 	}
 
-	if err := checker.CheckPackages(paths...); err != nil {
-		if e, ok := err.(*errcheck.UncheckedErrors); ok {
-			reportUncheckedErrors(e, checker.Verbose)
-			return exitUncheckedError
-		} else if err == errcheck.ErrNoGoFiles {
-			fmt.Fprintln(os.Stderr, err)
+	changes, loadErr := loadChanges()
+	if loadErr != nil {
+		fmt.Fprintf(os.Stderr, "error: failed to read changes: %s\n", loadErr)
+		return exitFatalError
+	}
+
+	if staged {
+		s, err := errcheck.GitStaged()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: failed to read staged files: %s\n", err)
+			return exitFatalError
+		}
+		if len(s.Dirs) == 0 {
 			return exitCodeOk
 		}
-		fmt.Fprintf(os.Stderr, "error: failed to check packages: %s\n", err)
+		if checker.Overlay == nil {
+			checker.Overlay = make(map[string][]byte)
+		}
+		for name, src := range s.Overlay {
+			checker.Overlay[name] = src
+		}
+		paths = packagePaths(s.Dirs)
+		changes = s.Changes
+	}
+
+	var checkErr error
+	var r *errcheck.Result
+	if modules {
+		dirs, err := errcheck.FindModules(".")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: failed to find modules: %s\n", err)
+			return exitFatalError
+		}
+		r, checkErr = checker.RunModules(dirs, paths...)
+	} else {
+		r, checkErr = checker.Run(paths...)
+	}
+	switch {
+	case checkErr == errcheck.ErrNoGoFiles:
+		fmt.Fprintln(os.Stderr, checkErr)
+		return exitCodeOk
+	case checkErr != nil:
+		fmt.Fprintf(os.Stderr, "error: failed to check packages: %s\n", checkErr)
+		return exitFatalError
+	case len(r.Diagnostics) > 0:
+		fmt.Fprintf(os.Stderr, "error: failed to check packages: %s\n", r.Diagnostics[0])
 		return exitFatalError
 	}
+	// Reports such as checkstyle are written even if there are no errors.
+	e := &errcheck.UncheckedErrors{Errors: r.Errors, Suppressed: r.Suppressed}
+
+	if changes != nil {
+		e.Filter(func(u errcheck.UncheckedError) bool {
+			// Changes are in the Go files, whatever line directives say.
+			return changes.Contains(u.Physical)
+		})
+	}
+	if emitExcludes {
+		writeExcludes(os.Stdout, e.Errors, emitExcludesByPackage)
+		return exitCodeOk
+	}
+	switch {
+	case formatTemplate != nil:
+		if err := writeTemplate(os.Stdout, formatTemplate, e.Errors); err != nil {
+			fmt.Fprintf(os.Stderr, "error: failed to write report: %s\n", err)
+			return exitFatalError
+		}
+	case format == "checkstyle":
+		if err := writeCheckstyle(os.Stdout, e.Errors); err != nil {
+			fmt.Fprintf(os.Stderr, "error: failed to write report: %s\n", err)
+			return exitFatalError
+		}
+	case format == "junit":
+		if err := writeJUnit(os.Stdout, r.Packages, e.Errors); err != nil {
+			fmt.Fprintf(os.Stderr, "error: failed to write report: %s\n", err)
+			return exitFatalError
+		}
+	default:
+		reportUncheckedErrors(e, checker.Verbose)
+		if checker.ShowSuppressed && len(e.Suppressed) > 0 {
+			reportSuppressed(e, checker.Ignore)
+		}
+	}
+	if e.Len() == 0 {
+		return exitCodeOk
+	}
+	return exitUncheckedError
+}
+
+// explainCmd implements "errcheck explain file.go:LINE[:COL]", which prints
+// how each call at the given position is checked.
+func explainCmd(args []string) int {
+	checker := errcheck.NewChecker()
+	positions, err := parseFlags(checker, args)
+	if err != exitCodeOk {
+		return err
+	}
+	if len(positions) != 1 || positions[0] == "." {
+		fmt.Fprintln(os.Stderr, "usage: errcheck explain [flags] file.go:LINE[:COL]")
+		return exitFatalError
+	}
+	filename, line, col, parseErr := parsePosition(positions[0])
+	if parseErr != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", parseErr)
+		return exitFatalError
+	}
+
+	explanations, explainErr := checker.Explain(filename, line, col)
+	if explainErr != nil {
+		fmt.Fprintf(os.Stderr, "error: failed to explain %s: %s\n", positions[0], explainErr)
+		return exitFatalError
+	}
+	if len(explanations) == 0 {
+		fmt.Printf("%s: no calls\n", positions[0])
+		return exitCodeOk
+	}
+
+	wd, wdErr := os.Getwd()
+	if wdErr != nil {
+		wd = ""
+	}
+	for _, e := range explanations {
+		fmt.Printf("%s:\t%s\n", relativePos(wd, e.Physical), e.Call)
+		fmt.Printf("\tposition:       %s\n", relativePos(wd, e.Pos))
+		fmt.Printf("\tstatement:      %s\n", e.Statement)
+		fmt.Printf("\tfull name:      %s\n", e.FuncName)
+		fmt.Printf("\texclude names:  %s\n", strings.Join(e.ExcludeNames, ", "))
+		fmt.Printf("\tfirst argument: %s\n", strings.Join(e.FirstArg, ", "))
+		fmt.Printf("\terrors by arg:  %v\n", e.ErrorsByArg)
+		fmt.Printf("\treturns error:  %v\n", e.ReturnsError)
+		rule := "none"
+		if e.SuppressedBy != "" {
+			rule = suppressionRule(e.SuppressedBy, checker.Ignore)
+		}
+		fmt.Printf("\tsuppressed by:  %s\n", rule)
+	}
 	return exitCodeOk
 }
 
+// writeExcludes writes an exclude file with an entry for each function whose
+// errors are unchecked, annotated with the number of unchecked calls. If
+// byPackage is true, the entries are listed separately for each package.
+func writeExcludes(w io.Writer, errors []errcheck.UncheckedError, byPackage bool) {
+	counts := make(map[string]map[string]int) // package -> entry -> count
+	var unnamed int
+	for _, e := range errors {
+		if e.ExcludeName == "" {
+			unnamed++
+			continue
+		}
+		pkg := ""
+		if byPackage {
+			pkg = e.Package
+		}
+		if counts[pkg] == nil {
+			counts[pkg] = make(map[string]int)
+		}
+		counts[pkg][e.ExcludeName]++
+	}
+
+	pkgs := make([]string, 0, len(counts))
+	for pkg := range counts {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Strings(pkgs)
+	for i, pkg := range pkgs {
+		if byPackage {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "// %s\n", pkg)
+		}
+		names := make([]string, 0, len(counts[pkg]))
+		for name := range counts[pkg] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(w, "%s // %d\n", name, counts[pkg][name])
+		}
+	}
+	if unnamed > 0 {
+		fmt.Fprintf(w, "// %d unchecked errors cannot be excluded by name\n", unnamed)
+	}
+}
+
+// excludesCmd implements "errcheck excludes", which prints the effective
+// exclude list along with the profile or file each entry comes from.
+func excludesCmd(args []string) int {
+	checker := errcheck.NewChecker()
+	if _, err := parseFlags(checker, args); err != exitCodeOk {
+		return err
+	}
+	for _, e := range checker.Excludes() {
+		fmt.Printf("%s\t// %s\n", e.Name, e.Source)
+	}
+	return exitCodeOk
+}
+
+// parsePosition parses a position of the form file.go:LINE[:COL].
+func parsePosition(s string) (filename string, line, col int, err error) {
+	// Parse from the right, as the file name may contain colons.
+	i := strings.LastIndex(s, ":")
+	if i <= 0 {
+		return "", 0, 0, fmt.Errorf("invalid position %q, want file.go:LINE[:COL]", s)
+	}
+	filename, lineText, colText := s[:i], s[i+1:], ""
+	if j := strings.LastIndex(filename, ":"); j > 0 {
+		if _, err := strconv.Atoi(filename[j+1:]); err == nil {
+			filename, lineText, colText = filename[:j], filename[j+1:], lineText
+		}
+	}
+	line, err = strconv.Atoi(lineText)
+	if err != nil || line < 1 {
+		return "", 0, 0, fmt.Errorf("invalid line in position %q", s)
+	}
+	if colText != "" {
+		col, err = strconv.Atoi(colText)
+		if err != nil || col < 1 {
+			return "", 0, 0, fmt.Errorf("invalid column in position %q", s)
+		}
+	}
+	return filename, line, col, nil
+}
+
+// loadChanges returns the changed lines selected by -new-from-rev or
+// -new-from-patch, or nil if every line should be reported.
+func loadChanges() (errcheck.Changes, error) {
+	switch {
+	case newFromRev != "":
+		return errcheck.GitChanges(newFromRev)
+	case newFromPatch != "":
+		fh, err := os.Open(newFromPatch)
+		if err != nil {
+			return nil, err
+		}
+		defer fh.Close()
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		return errcheck.ParseDiff(fh, wd)
+	}
+	return nil, nil
+}
+
+// packagePaths returns package patterns for the given absolute directories,
+// relative to the current directory where possible.
+func packagePaths(dirs []string) []string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return dirs
+	}
+	paths := make([]string, len(dirs))
+	for i, dir := range dirs {
+		rel, err := filepath.Rel(wd, dir)
+		if err != nil {
+			paths[i] = dir
+			continue
+		}
+		if rel != "." && !strings.HasPrefix(rel, "..") {
+			rel = "." + string(filepath.Separator) + rel
+		}
+		paths[i] = rel
+	}
+	return paths
+}
+
 func parseFlags(checker *errcheck.Checker, args []string) ([]string, int) {
 	flags := flag.NewFlagSet(args[0], flag.ContinueOnError)
 	flags.BoolVar(&checker.Blank, "blank", false, "if true, check for errors assigned to blank identifier")
 	flags.BoolVar(&checker.Asserts, "asserts", false, "if true, check for ignored type assertion results")
 	flags.BoolVar(&checker.WithoutTests, "ignoretests", false, "if true, checking of _test.go files is disabled")
 	flags.BoolVar(&checker.WithoutGeneratedCode, "ignoregenerated", false, "if true, checking of files with generated code is disabled")
+	flags.BoolVar(&checker.DeferClose, "deferclose", false, "if true, ignore deferred Close calls on read-only files and explain those on writable files")
+	flags.BoolVar(&checker.IgnoreLineDirectives, "ignore-line-directives", false, "if true, report errors at their positions in the Go files rather than those given by //line directives")
+	flags.BoolVar(&checker.Iterators, "iterators", false, "if true, check for iterators such as bufio.Scanner whose deferred error is never consulted")
 	flags.BoolVar(&checker.Verbose, "verbose", false, "produce more verbose logging")
+	debug := flags.Bool("debug", false, "log to stderr how packages are loaded and why each call is checked, excluded or ignored")
 
 	flags.BoolVar(&abspath, "abspath", false, "print absolute paths to files")
+	flags.BoolVar(&checker.ShowSuppressed, "show-suppressed", false, "also report excluded and ignored calls along with the rule suppressing them")
+	flags.StringVar(&newFromRev, "new-from-rev", "", "only report errors on lines added or modified since the given git revision")
+	flags.StringVar(&newFromPatch, "new-from-patch", "", "only report errors on lines added or modified by the given unified diff")
+	flags.BoolVar(&staged, "staged", false, "check the files staged in the git index and only report errors in staged lines")
+	flags.BoolVar(&modules, "modules", false, "check the packages in every module of the go.work file in the current directory, or every go.mod beneath it")
+	flags.StringVar(&format, "format", "text", "report format: text, checkstyle or junit")
+	templateText := flags.String("format-template", "", "text/template rendering each error, or one of the presets vet, quickfix and github")
+	flags.BoolVar(&emitExcludes, "emit-excludes", false, "print an exclude file for the unchecked errors, with the number of calls per function, instead of reporting them")
+	flags.BoolVar(&emitExcludesByPackage, "emit-excludes-by-package", false, "with -emit-excludes, list the functions separately for each package")
 
 	tags := tagsFlag{}
 	flags.Var(&tags, "tags", "space-separated list of build tags to include")
+	platforms := platformsFlag{}
+	flags.Var(&platforms, "matrix", "comma-separated list of GOOS/GOARCH platforms to check packages for")
+	tagSets := tagSetsFlag{}
+	flags.Var(&tagSets, "matrix-tags", "space-separated list of build tags of a configuration to check, in addition to -tags;\n"+
+		"            may be repeated, and is combined with each platform of -matrix")
 	ignorePkg := flags.String("ignorepkg", "", "comma-separated list of package paths to ignore")
 	ignore := ignoreFlag(map[string]*regexp.Regexp{})
 	flags.Var(ignore, "ignore", "[deprecated] comma-separated list of pairs of the form pkg:regex\n"+
 		"            the regex is used to ignore names within pkg.")
 
+	iterators := iteratorsFlag{}
+	flags.Var(&iterators, "iterator", "comma-separated list of additional iterator types of the form (TYPE).ADVANCE:ERR")
+
 	var excludeFile string
 	flags.StringVar(&excludeFile, "exclude", "", "Path to a file containing a list of functions to exclude from checking")
 
+	excludeProfile := flags.String("exclude-profile", errcheck.DefaultExcludeProfile,
+		"built-in list of functions to exclude from checking: "+strings.Join(errcheck.ExcludeProfiles, ", "))
+
+	var overlayFile string
+	flags.StringVar(&overlayFile, "overlay", "", "Path to a JSON file, in the format used by go build -overlay, that replaces file contents")
+
 	if err := flags.Parse(args[1:]); err != nil {
 		return nil, exitFatalError
 	}
+	if (newFromRev != "" && newFromPatch != "") || (staged && (newFromRev != "" || newFromPatch != "")) {
+		fmt.Fprintln(os.Stderr, "-new-from-rev, -new-from-patch and -staged are mutually exclusive")
+		return nil, exitFatalError
+	}
+	if staged && modules {
+		fmt.Fprintln(os.Stderr, "-staged and -modules are mutually exclusive")
+		return nil, exitFatalError
+	}
+	if staged && flags.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "-staged checks the packages of the staged files and accepts no package arguments")
+		return nil, exitFatalError
+	}
+	switch format {
+	case "text", "checkstyle", "junit":
+	default:
+		fmt.Fprintf(os.Stderr, "unknown format %q, want text, checkstyle or junit\n", format)
+		return nil, exitFatalError
+	}
+	formatTemplate = nil
+	if *templateText != "" {
+		if format != "text" {
+			fmt.Fprintln(os.Stderr, "-format and -format-template are mutually exclusive")
+			return nil, exitFatalError
+		}
+		tmpl, err := parseFormatTemplate(*templateText)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not parse format template: %s\n", err)
+			return nil, exitFatalError
+		}
+		formatTemplate = tmpl
+	}
+
+	if *debug {
+		checker.Logger = errcheck.NewLogger(os.Stderr, errcheck.LogTrace)
+	}
+
+	if err := checker.SetExcludeProfile(*excludeProfile); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return nil, exitFatalError
+	}
 
 	if excludeFile != "" {
 		exclude := make(map[string]bool)
@@ -161,6 +669,14 @@ func parseFlags(checker *errcheck.Checker, args []string) ([]string, int) {
 		scanner := bufio.NewScanner(fh)
 		for scanner.Scan() {
 			name := scanner.Text()
+			// Skip comments, including the counts written by -emit-excludes.
+			if i := strings.Index(name, "//"); i != -1 {
+				name = name[:i]
+			}
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
 			exclude[name] = true
 
 			if checker.Verbose {
@@ -174,7 +690,23 @@ func parseFlags(checker *errcheck.Checker, args []string) ([]string, int) {
 		checker.SetExclude(exclude)
 	}
 
+	if overlayFile != "" {
+		overlay, err := readOverlay(overlayFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not read overlay file: %s\n", err)
+			return nil, exitFatalError
+		}
+		checker.Overlay = overlay
+	}
+
+	if len(iterators) > 0 {
+		checker.IteratorTypes = append(append([]errcheck.IteratorType{}, checker.IteratorTypes...), iterators...)
+	}
+
 	checker.Tags = tags
+	if len(platforms) > 0 || len(tagSets) > 0 {
+		checker.Configs = buildMatrix(platforms, tagSets)
+	}
 	for _, pkg := range strings.Split(*ignorePkg, ",") {
 		if pkg != "" {
 			ignore[pkg] = dotStar
@@ -185,10 +717,45 @@ func parseFlags(checker *errcheck.Checker, args []string) ([]string, int) {
 	paths := flags.Args()
 	if len(paths) == 0 {
 		paths = []string{"."}
+		if modules {
+			paths = []string{"./..."}
+		}
 	}
 	return paths, exitCodeOk
 }
 
+// readOverlay reads a JSON file in the format accepted by go build -overlay
+// and returns the replacement contents keyed by absolute file path.
+func readOverlay(filename string) (map[string][]byte, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var spec struct {
+		Replace map[string]string
+	}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, err
+	}
+
+	overlay := make(map[string][]byte, len(spec.Replace))
+	for from, to := range spec.Replace {
+		if to == "" {
+			return nil, fmt.Errorf("deleting %s is not supported", from)
+		}
+		path, err := filepath.Abs(from)
+		if err != nil {
+			return nil, err
+		}
+		src, err := ioutil.ReadFile(to)
+		if err != nil {
+			return nil, err
+		}
+		overlay[path] = src
+	}
+	return overlay, nil
+}
+
 func main() {
 	os.Exit(mainCmd(os.Args))
 }
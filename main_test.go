@@ -3,7 +3,10 @@ package main
 import (
 	"bytes"
 	"io"
+	"io/ioutil"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"testing"
@@ -54,7 +57,7 @@ func TestMain(t *testing.T) {
 		t.Errorf("Exit code is %d, expected %d", exitCode, exitUncheckedError)
 	}
 
-	expectUnchecked := 29
+	expectUnchecked := 35
 	if got := strings.Count(out, "UNCHECKED"); got != expectUnchecked {
 		t.Errorf("Got %d UNCHECKED errors, expected %d in:\n%s", got, expectUnchecked, out)
 	}
@@ -171,6 +174,15 @@ func TestParseFlags(t *testing.T) {
 			asserts: false,
 			error:   exitCodeOk,
 		},
+		parseTestCase{
+			args:    []string{"errcheck", "-staged", "foo"},
+			paths:   nil,
+			ignore:  nil,
+			tags:    nil,
+			blank:   false,
+			asserts: false,
+			error:   exitFatalError,
+		},
 	}
 
 	slicesEqual := func(a, b []string) bool {
@@ -222,3 +234,258 @@ func TestParseFlags(t *testing.T) {
 		}
 	}
 }
+
+func TestReadOverlay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "testreadoverlay")
+	if err != nil {
+		t.Fatalf("unable to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	replacement := filepath.Join(dir, "replacement.go")
+	if err := ioutil.WriteFile(replacement, []byte("package main\n"), 0644); err != nil {
+		t.Fatalf("Failed to write replacement: %v", err)
+	}
+	spec := filepath.Join(dir, "overlay.json")
+	json := `{"Replace": {"main.go": "` + replacement + `"}}`
+	if err := ioutil.WriteFile(spec, []byte(json), 0644); err != nil {
+		t.Fatalf("Failed to write overlay: %v", err)
+	}
+
+	overlay, err := readOverlay(spec)
+	if err != nil {
+		t.Fatalf("readOverlay failed: %v", err)
+	}
+	abs, err := filepath.Abs("main.go")
+	if err != nil {
+		t.Fatalf("Abs failed: %v", err)
+	}
+	if got := string(overlay[abs]); got != "package main\n" {
+		t.Errorf("overlay[%q] got %q want %q", abs, got, "package main\n")
+	}
+}
+
+func TestPackagePaths(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Cannot receive current directory: %v", err)
+	}
+	dirs := []string{wd, filepath.Join(wd, "testdata"), filepath.Dir(wd)}
+	want := []string{".", "./testdata", ".."}
+	for i, got := range packagePaths(dirs) {
+		if filepath.ToSlash(got) != want[i] {
+			t.Errorf("packagePaths(%q) got %q want %q", dirs[i], got, want[i])
+		}
+	}
+}
+
+func TestSuppressionRule(t *testing.T) {
+	ignore := map[string]*regexp.Regexp{
+		"fmt":     regexp.MustCompile(".*"),
+		"testing": dotStar,
+	}
+	cases := map[string]string{
+		"default-exclude: fmt.Printf": "default-exclude: fmt.Printf",
+		"ignore: fmt:.*":              "ignore: fmt:.*",
+		"ignore: testing:.*":          "ignorepkg: testing",
+		"ignore: [rR]ead":             "ignore: [rR]ead",
+	}
+	for rule, want := range cases {
+		if got := suppressionRule(rule, ignore); got != want {
+			t.Errorf("suppressionRule(%q) got %q want %q", rule, got, want)
+		}
+	}
+}
+
+func TestParsePosition(t *testing.T) {
+	cases := []struct {
+		pos      string
+		filename string
+		line     int
+		col      int
+		ok       bool
+	}{
+		{"main.go:12", "main.go", 12, 0, true},
+		{"main.go:12:5", "main.go", 12, 5, true},
+		{"c:/src/main.go:12:5", "c:/src/main.go", 12, 5, true},
+		{"c:/src/main.go:12", "c:/src/main.go", 12, 0, true},
+		{"a:1/main.go:12", "a:1/main.go", 12, 0, true},
+		{":12", "", 0, 0, false},
+		{"main.go", "", 0, 0, false},
+		{"main.go:x", "", 0, 0, false},
+		{"main.go:12:0", "", 0, 0, false},
+	}
+	for _, c := range cases {
+		filename, line, col, err := parsePosition(c.pos)
+		if (err == nil) != c.ok || filename != c.filename || line != c.line || col != c.col {
+			t.Errorf("parsePosition(%q) got (%q, %d, %d, %v)", c.pos, filename, line, col, err)
+		}
+	}
+}
+
+func TestWriteExcludes(t *testing.T) {
+	errors := []errcheck.UncheckedError{
+		{Package: "example.com/b", ExcludeName: "(*os.File).Close"},
+		{Package: "example.com/a", ExcludeName: "os.Remove"},
+		{Package: "example.com/a", ExcludeName: "(*os.File).Close"},
+		{Package: "example.com/a", ExcludeName: "(*os.File).Close"},
+		{Package: "example.com/a"},
+	}
+
+	var buf bytes.Buffer
+	writeExcludes(&buf, errors, false)
+	want := `(*os.File).Close // 3
+os.Remove // 1
+// 1 unchecked errors cannot be excluded by name
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	buf.Reset()
+	writeExcludes(&buf, errors, true)
+	want = `// example.com/a
+(*os.File).Close // 2
+os.Remove // 1
+
+// example.com/b
+(*os.File).Close // 1
+// 1 unchecked errors cannot be excluded by name
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestBuildMatrix(t *testing.T) {
+	checker := &errcheck.Checker{}
+	args := []string{"errcheck", "-tags", "foo", "-matrix", "linux/amd64,windows/arm64", "-matrix-tags", "", "-matrix-tags", "integration e2e"}
+	if _, e := parseFlags(checker, args); e != exitCodeOk {
+		t.Fatalf("error got %d want %d", e, exitCodeOk)
+	}
+	var got []string
+	for _, config := range checker.Configs {
+		got = append(got, config.String())
+	}
+	want := []string{"linux/amd64", "linux/amd64 [integration e2e]", "windows/arm64", "windows/arm64 [integration e2e]"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("configs got %q want %q", got, want)
+	}
+
+	checker = &errcheck.Checker{}
+	if _, e := parseFlags(checker, []string{"errcheck", "-matrix-tags", "integration"}); e != exitCodeOk {
+		t.Fatalf("error got %d want %d", e, exitCodeOk)
+	}
+	if len(checker.Configs) != 1 || checker.Configs[0].String() != "[integration]" {
+		t.Errorf("configs got %v want [integration]", checker.Configs)
+	}
+
+	saveStderr := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	defer func() { os.Stderr = saveStderr }()
+	if _, e := parseFlags(&errcheck.Checker{}, []string{"errcheck", "-matrix", "linux"}); e != exitFatalError {
+		t.Errorf("invalid platform: error got %d want %d", e, exitFatalError)
+	}
+}
+
+// runMain runs mainCmd with args and returns its exit code and output.
+func runMain(t *testing.T, args ...string) (int, string) {
+	saveStderr := os.Stderr
+	saveStdout := os.Stdout
+	defer func() {
+		os.Stderr = saveStderr
+		os.Stdout = saveStdout
+	}()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Cannot create pipe: %v", err)
+	}
+	os.Stderr = w
+	os.Stdout = w
+
+	bufChannel := make(chan string)
+	go func() {
+		buf := new(bytes.Buffer)
+		io.Copy(buf, r)
+		r.Close()
+		bufChannel <- buf.String()
+	}()
+
+	exitCode := mainCmd(append([]string{"errcheck"}, args...))
+	w.Close()
+	return exitCode, <-bufChannel
+}
+
+func TestStaged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "teststaged")
+	if err != nil {
+		t.Fatalf("unable to create teststaged directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	saveCwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Cannot receive current directory: %v", err)
+	}
+	defer os.Chdir(saveCwd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Chdir failed: %v", err)
+	}
+
+	write := func(name, src string) {
+		if err := ioutil.WriteFile(name, []byte(src), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	git := func(args ...string) {
+		cmd := exec.Command("git", args...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s failed: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+
+	write("go.mod", "module example.com/staged\n\ngo 1.21\n")
+	write("a.go", "package a\n\nfunc f() error { return nil }\n\nfunc g() { f() }\n")
+	write("c.go", "package a\n\nfunc h() {}\n")
+	git("init", "-q")
+	git("add", ".")
+	git("-c", "user.name=errcheck", "-c", "user.email=errcheck@example.com", "commit", "-q", "-m", "initial")
+
+	// The staged a.go declares h, which the deleted c.go declares too.
+	write("a.go", "package a\n\nfunc f() error { return nil }\n\nfunc g() { f() }\n\nfunc h() { f() }\n")
+	git("add", "a.go")
+	git("rm", "-q", "--cached", "c.go")
+	// Neither the unstaged change nor the untracked b.go is checked.
+	write("a.go", "package a\n\nfunc f() error { return nil }\n\nfunc g() { f() }\n\nfunc h() { f() }\n\nfunc i() { f() }\n")
+	write("b.go", "package a\n\nfunc f() {}\n")
+
+	exitCode, out := runMain(t, "-staged")
+	if exitCode != exitUncheckedError {
+		t.Errorf("Exit code is %d, expected %d in:\n%s", exitCode, exitUncheckedError, out)
+	}
+	if want := "a.go:7:13:\tfunc h() { f() }\n"; out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+
+	if exitCode, _ := runMain(t, "-staged", "."); exitCode != exitFatalError {
+		t.Errorf("Exit code with package arguments is %d, expected %d", exitCode, exitFatalError)
+	}
+
+	// git resolves the symbolic links go/packages keeps in file names.
+	link := dir + ".link"
+	if err := os.Symlink(dir, link); err != nil {
+		t.Skipf("Symlink failed: %v", err)
+	}
+	defer os.Remove(link)
+	if err := os.Chdir(link); err != nil {
+		t.Fatalf("Chdir failed: %v", err)
+	}
+	t.Setenv("PWD", link)
+	exitCode, out = runMain(t, "-staged")
+	if exitCode != exitUncheckedError {
+		t.Errorf("Exit code through a symbolic link is %d, expected %d in:\n%s", exitCode, exitUncheckedError, out)
+	}
+	if want := "a.go:7:13:\tfunc h() { f() }\n"; out != want {
+		t.Errorf("got output through a symbolic link %q, want %q", out, want)
+	}
+}
@@ -0,0 +1,12 @@
+package main
+
+import (
+	. "fmt"
+	"os"
+)
+
+func dotImport() {
+	Println("this function is dot-imported")             // EXCLUDED
+	Fprintln(os.Stderr, "this function is dot-imported") // EXCLUDED
+	Fprintln(os.Stdin, "this function is dot-imported")  // UNCHECKED
+}
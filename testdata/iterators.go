@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"os"
+)
+
+func scanUnchecked() {
+	s := bufio.NewScanner(os.Stdin)
+	for s.Scan() { // ITERATOR
+	}
+}
+
+func scanChecked() error {
+	s := bufio.NewScanner(os.Stdin)
+	for s.Scan() {
+	}
+	return s.Err()
+}
+
+func scanEscapes() *bufio.Scanner {
+	s := bufio.NewScanner(os.Stdin)
+	s.Scan()
+	return s
+}
+
+func scanParam(s *bufio.Scanner) {
+	for s.Scan() {
+	}
+}
+
+func rowsUnchecked(db *sql.DB) {
+	rows, err := db.Query("SELECT 1")
+	if err != nil {
+		return
+	}
+	for rows.Next() { // ITERATOR
+	}
+}
+
+func rowsChecked(db *sql.DB) error {
+	rows, err := db.Query("SELECT 1")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+	}
+	return rows.Err()
+}
+
+var scanLiteral = func() {
+	s := bufio.NewScanner(os.Stdin)
+	s.Scan() // ITERATOR
+}
@@ -9,6 +9,7 @@ func (x t) a() error {
 	fmt.Println("this method returns an error") // EXCLUDED
 //line myfile.txt:100
 	fmt.Println("this method also returns an error") // EXCLUDED
+	a()                                              // UNCHECKED
 	return nil
 }
 
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"text/tabwriter"
+)
+
+func stickyFlushChecked() error {
+	w := bufio.NewWriter(os.Stdout)
+	w.WriteString("sticky")
+	w.WriteByte('\n')
+	return w.Flush()
+}
+
+func stickyFlushUnchecked() {
+	w := bufio.NewWriter(os.Stdout)
+	w.WriteString("sticky")
+	w.Flush() // UNCHECKED
+}
+
+func stickyFlushMissing() {
+	w := bufio.NewWriter(os.Stdout)
+	w.WriteString("sticky") // UNCHECKED
+	w.WriteByte('\n')
+}
+
+func stickyFlushEarlier() error {
+	w := bufio.NewWriter(os.Stdout)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	w.WriteString("sticky") // UNCHECKED
+	return nil
+}
+
+func stickyFlushDeferred() {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 1, ' ', 0)
+	defer tw.Flush() // UNCHECKED
+	tw.Write([]byte("a\tb\n"))
+}
+
+func stickyFlushDeferredChecked() (err error) {
+	w := bufio.NewWriter(os.Stdout)
+	defer func() {
+		if ferr := w.Flush(); err == nil {
+			err = ferr
+		}
+	}()
+	w.WriteString("sticky")
+	return nil
+}
+
+func stickyFlushBlank() {
+	w := bufio.NewWriter(os.Stdout)
+	w.WriteString("sticky")
+	_ = w.Flush() // BLANK
+}